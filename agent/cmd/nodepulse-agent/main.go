@@ -43,7 +43,7 @@ func main() {
 	logger.Info("Config: %s", cfg)
 
 	// Create collector
-	coll := collector.New()
+	coll := collector.New(cfg)
 
 	// Create WebSocket client
 	client := websocket.NewClient(cfg.ServerURL, cfg.APIKey, Version, runtime.GOARCH)
@@ -62,6 +62,22 @@ func main() {
 				Success: true,
 				Data:    metrics,
 			}
+		case "get_processes":
+			// Top samples for a second; reply from a goroutine so the
+			// read loop keeps handling pings meanwhile
+			limit, _ := cmd.Args["limit"].(float64)
+			go func(id string) {
+				resp := &websocket.ResponseMessage{
+					Type:    websocket.TypeResponse,
+					ID:      id,
+					Success: true,
+					Data:    coll.TopProcesses(int(limit)),
+				}
+				if err := client.Send(resp); err != nil {
+					logger.Warn("Failed to send processes for command %s: %v", id, err)
+				}
+			}(cmd.ID)
+			return nil
 		default:
 			return &websocket.ResponseMessage{
 				Type:    websocket.TypeResponse,
@@ -72,6 +88,15 @@ func main() {
 		}
 	})
 
+	// Send the full inventory on every connect
+	client.SetInventoryProvider(func() interface{} {
+		// Connect sends it right away; if that fails the connection is
+		// broken and the next connect sends it again
+		inventory := coll.Inventory(true)
+		coll.InventorySent(inventory)
+		return inventory
+	})
+
 	// Connect to server
 	if err := client.Connect(); err != nil {
 		logger.Error("Failed to connect: %v", err)
@@ -98,9 +123,32 @@ func main() {
 				if err := client.SendMetrics(metrics); err != nil {
 					logger.Warn("Failed to send metrics: %v", err)
 				} else {
+					coll.MetricsSent(metrics)
 					logger.Debug("Sent metrics: CPU=%.1f%%, RAM=%.1f%%, Disk=%.1f%%",
 						metrics.CPUPercent, metrics.RAMPercent, metrics.DiskPercent)
 				}
+
+				// Send the inventory again if it changed
+				if inventory := coll.Inventory(false); inventory != nil {
+					if err := client.SendInventory(inventory); err != nil {
+						logger.Warn("Failed to send inventory: %v", err)
+					} else {
+						coll.InventorySent(inventory)
+						logger.Info("Sent changed inventory")
+					}
+				}
+
+				// Send events raised during collection, and keep the
+				// unsent ones for the next push if the connection fails
+				events := coll.Events()
+				for i, event := range events {
+					if err := client.SendEvent(event.Type, event.Data); err != nil {
+						logger.Warn("Failed to send event %s, retrying with next push: %v", event.Type, err)
+						coll.Requeue(events[i:]...)
+						break
+					}
+					logger.Info("Sent event: %s", event.Type)
+				}
 			}
 
 		case sig := <-sigCh:
@@ -0,0 +1,253 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cgroup kinds reported in CgroupStats.Kind.
+const (
+	CgroupService = "service"
+	CgroupScope   = "scope"
+	CgroupLXC     = "lxc"
+	CgroupDocker  = "docker"
+	CgroupQEMU    = "qemu"
+	CgroupMachine = "machine"
+)
+
+// CgroupStats holds resource usage of a single cgroup over the last interval.
+type CgroupStats struct {
+	Path               string  `json:"path"`
+	Kind               string  `json:"kind"`
+	Name               string  `json:"name"`
+	CPUPercent         float64 `json:"cpu_percent"` // 100 = one full core
+	MemoryBytes        int64   `json:"memory_bytes"`
+	MemoryMaxBytes     int64   `json:"memory_max_bytes"` // 0 = unlimited
+	IOReadBytesPerSec  float64 `json:"io_read_bytes_per_sec"`
+	IOWriteBytesPerSec float64 `json:"io_write_bytes_per_sec"`
+	IOReadIOPS         float64 `json:"io_read_iops"`
+	IOWriteIOPS        float64 `json:"io_write_iops"`
+	Pids               int64   `json:"pids"`
+}
+
+// cgroupCounters holds the cumulative counters needed for rates.
+type cgroupCounters struct {
+	usageUsec      uint64
+	rbytes, wbytes uint64
+	rios, wios     uint64
+}
+
+// CgroupCollector walks the cgroup v2 tree and reports per-service and
+// per-guest resource usage.
+type CgroupCollector struct {
+	mu         sync.Mutex
+	cgroupPath string
+	prev       map[string]cgroupCounters
+	prevTime   time.Time
+}
+
+// NewCgroupCollector creates a new cgroup collector reading the cgroup
+// filesystem mounted at cgroupPath.
+func NewCgroupCollector(cgroupPath string) *CgroupCollector {
+	c := &CgroupCollector{
+		cgroupPath: cgroupPath,
+		prev:       make(map[string]cgroupCounters),
+	}
+	// Take an initial reading to establish baseline
+	c.Collect()
+	return c
+}
+
+// Collect returns usage for all known service, container and VM cgroups.
+// It returns nil if cgroup v2 is not mounted.
+func (c *CgroupCollector) Collect() []CgroupStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	root := findCgroup2Root(c.cgroupPath)
+	if root == "" {
+		return nil
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(c.prevTime).Seconds()
+	cur := make(map[string]cgroupCounters)
+
+	var result []CgroupStats
+	for _, rel := range listCgroups(root) {
+		kind, name := cgroupName(rel)
+		if kind == "" {
+			continue
+		}
+
+		s, counters := readCgroup(filepath.Join(root, rel))
+		s.Path = rel
+		s.Kind = kind
+		s.Name = name
+
+		if prev, ok := c.prev[rel]; ok && elapsed > 0 {
+			s.CPUPercent = 100.0 * float64(sub(counters.usageUsec, prev.usageUsec)) / 1e6 / elapsed
+			s.IOReadBytesPerSec = float64(sub(counters.rbytes, prev.rbytes)) / elapsed
+			s.IOWriteBytesPerSec = float64(sub(counters.wbytes, prev.wbytes)) / elapsed
+			s.IOReadIOPS = float64(sub(counters.rios, prev.rios)) / elapsed
+			s.IOWriteIOPS = float64(sub(counters.wios, prev.wios)) / elapsed
+		}
+
+		cur[rel] = counters
+		result = append(result, s)
+	}
+
+	c.prev = cur
+	c.prevTime = now
+
+	return result
+}
+
+// listCgroups returns the cgroups (relative to root) that may represent a
+// service, container or VM: the top level and the children of top-level
+// groups. Deeper levels are sub-groups of those (e.g. lxc/101/ns) and
+// would be counted twice.
+func listCgroups(root string) []string {
+	var groups []string
+
+	top, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+
+	for _, t := range top {
+		if !t.IsDir() {
+			continue
+		}
+		groups = append(groups, t.Name())
+
+		children, err := os.ReadDir(filepath.Join(root, t.Name()))
+		if err != nil {
+			continue
+		}
+		for _, child := range children {
+			if child.IsDir() {
+				groups = append(groups, t.Name()+"/"+child.Name())
+			}
+		}
+	}
+
+	return groups
+}
+
+// cgroupName derives kind and display name from a cgroup path. It returns
+// an empty kind for cgroups that are not reported.
+//
+//	system.slice/nginx.service          -> service, nginx
+//	system.slice/docker-<id>.scope      -> docker, <id[:12]>
+//	docker/<id>                         -> docker, <id[:12]>
+//	lxc/101, lxc.payload.web            -> lxc, 101 / web
+//	qemu.slice/100.scope                -> qemu, 100
+//	machine.slice/machine-foo.scope     -> machine, foo
+func cgroupName(rel string) (kind, name string) {
+	parent, child, nested := strings.Cut(rel, "/")
+
+	if !nested {
+		if strings.HasPrefix(parent, "lxc.payload.") {
+			return CgroupLXC, strings.TrimPrefix(parent, "lxc.payload.")
+		}
+		return "", ""
+	}
+
+	switch parent {
+	case "system.slice":
+		switch {
+		case strings.HasPrefix(child, "docker-") && strings.HasSuffix(child, ".scope"):
+			return CgroupDocker, shortID(strings.TrimSuffix(strings.TrimPrefix(child, "docker-"), ".scope"))
+		case strings.HasSuffix(child, ".service"):
+			return CgroupService, strings.TrimSuffix(child, ".service")
+		case strings.HasSuffix(child, ".scope"):
+			return CgroupScope, strings.TrimSuffix(child, ".scope")
+		}
+	case "docker":
+		return CgroupDocker, shortID(child)
+	case "lxc":
+		return CgroupLXC, child
+	case "qemu.slice":
+		return CgroupQEMU, strings.TrimSuffix(child, ".scope")
+	case "machine.slice":
+		name := strings.TrimSuffix(child, ".scope")
+		return CgroupMachine, strings.TrimPrefix(name, "machine-")
+	}
+
+	return "", ""
+}
+
+// shortID shortens a container ID the way `docker ps` does.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// readCgroup reads the accounting files of one cgroup directory.
+func readCgroup(dir string) (CgroupStats, cgroupCounters) {
+	var s CgroupStats
+	var c cgroupCounters
+
+	c.usageUsec = readFlatKeyed(filepath.Join(dir, "cpu.stat"))["usage_usec"]
+
+	s.MemoryBytes, _ = readInt(filepath.Join(dir, "memory.current"))
+	s.MemoryMaxBytes, _ = readInt(filepath.Join(dir, "memory.max")) // "max" parses as 0
+	s.Pids, _ = readInt(filepath.Join(dir, "pids.current"))
+
+	// io.stat: "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0" per device
+	if data, err := os.ReadFile(filepath.Join(dir, "io.stat")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			for _, kv := range strings.Fields(line) {
+				key, value, ok := strings.Cut(kv, "=")
+				if !ok {
+					continue
+				}
+				v, _ := strconv.ParseUint(value, 10, 64)
+				switch key {
+				case "rbytes":
+					c.rbytes += v
+				case "wbytes":
+					c.wbytes += v
+				case "rios":
+					c.rios += v
+				case "wios":
+					c.wios += v
+				}
+			}
+		}
+	}
+
+	return s, c
+}
+
+// readFlatKeyed parses a "key value" per line file such as cpu.stat.
+func readFlatKeyed(path string) map[string]uint64 {
+	values := make(map[string]uint64)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// EventClockUnsynced is raised when the kernel clock loses synchronisation.
+const EventClockUnsynced = "clock_unsynced"
+
+// timeDaemonInterval is how often the process list is scanned for a time
+// daemon.
+const timeDaemonInterval = 60 * time.Second
+
+// adjtimex status bits and states, see adjtimex(2)
+const (
+	staUnsync = 0x0040 // clock unsynchronized
+	staNano   = 0x2000 // offset in nanoseconds instead of microseconds
+	timeError = 5      // TIME_ERROR: clock not synchronized
+)
+
+// timeDaemons maps process names (comm, at most 15 characters) to the
+// reported daemon name.
+var timeDaemons = map[string]string{
+	"chronyd":         "chrony",
+	"systemd-timesyn": "systemd-timesyncd",
+	"ntpd":            "ntpd",
+	"openntpd":        "openntpd",
+	"ptp4l":           "ptp4l",
+}
+
+// ClockStats holds the kernel clock discipline state from adjtimex.
+type ClockStats struct {
+	Synced       bool    `json:"synced"`
+	OffsetMs     float64 `json:"offset_ms"`
+	EstErrorMs   float64 `json:"est_error_ms"`
+	MaxErrorMs   float64 `json:"max_error_ms"`
+	FrequencyPPM float64 `json:"frequency_ppm"`
+	Status       int32   `json:"status"` // raw STA_* bits
+	Daemon       string  `json:"daemon,omitempty"`
+}
+
+// ClockCollector reports the clock synchronisation state.
+type ClockCollector struct {
+	mu         sync.Mutex
+	procPath   string
+	adjtimex   func(*syscall.Timex) (int, error)
+	prevSynced bool
+	daemon     string
+	lastDaemon time.Time
+}
+
+// NewClockCollector creates a new clock collector.
+func NewClockCollector() *ClockCollector {
+	return &ClockCollector{
+		procPath: "/proc",
+		adjtimex: syscall.Adjtimex,
+	}
+}
+
+// Collect returns the clock state and a clock_unsynced event when the
+// clock was synchronised on the previous call but is not anymore.
+func (c *ClockCollector) Collect() (*ClockStats, []Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// With Modes == 0 adjtimex only reads the state
+	var tx syscall.Timex
+	state, err := c.adjtimex(&tx)
+	if err != nil {
+		return nil, nil
+	}
+
+	offsetUnit := 1e3 // us -> ms
+	if int64(tx.Status)&staNano != 0 {
+		offsetUnit = 1e6 // ns -> ms
+	}
+
+	stats := &ClockStats{
+		Synced:       state != timeError && int64(tx.Status)&staUnsync == 0,
+		OffsetMs:     float64(tx.Offset) / offsetUnit,
+		EstErrorMs:   float64(tx.Esterror) / 1e3,
+		MaxErrorMs:   float64(tx.Maxerror) / 1e3,
+		FrequencyPPM: float64(tx.Freq) / 65536, // scaled ppm, 16 bit fraction
+		Status:       int32(tx.Status),
+	}
+
+	if time.Since(c.lastDaemon) >= timeDaemonInterval {
+		c.lastDaemon = time.Now()
+		c.daemon = c.findTimeDaemon()
+	}
+	stats.Daemon = c.daemon
+
+	var events []Event
+	if c.prevSynced && !stats.Synced {
+		events = append(events, newEvent(EventClockUnsynced, map[string]interface{}{
+			"daemon":       stats.Daemon,
+			"max_error_ms": stats.MaxErrorMs,
+			"status":       stats.Status,
+		}))
+	}
+	c.prevSynced = stats.Synced
+
+	return stats, events
+}
+
+// findTimeDaemon returns the first known time daemon in the process list.
+func (c *ClockCollector) findTimeDaemon() string {
+	entries, err := os.ReadDir(c.procPath)
+	if err != nil {
+		return ""
+	}
+
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		comm := readString(filepath.Join(c.procPath, e.Name(), "comm"))
+		if name, ok := timeDaemons[comm]; ok {
+			return name
+		}
+	}
+
+	return ""
+}
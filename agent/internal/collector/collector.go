@@ -4,43 +4,120 @@ package collector
 import (
 	"sync"
 	"time"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
 )
 
 // Metrics holds all collected system metrics.
 // Field names match exactly what the NodePulse server expects.
 type Metrics struct {
-	Timestamp         int64    `json:"timestamp"`
-	CPUPercent        float64  `json:"cpu_percent"`
-	Load1m            float64  `json:"load_1m"`
-	Load5m            float64  `json:"load_5m"`
-	Load15m           float64  `json:"load_15m"`
-	RAMUsedBytes      int64    `json:"ram_used_bytes"`
-	RAMAvailableBytes int64    `json:"ram_available_bytes"`
-	RAMPercent        float64  `json:"ram_percent"`
-	SwapUsedBytes     int64    `json:"swap_used_bytes"`
-	DiskUsedBytes     int64    `json:"disk_used_bytes"`
-	DiskAvailableBytes int64   `json:"disk_available_bytes"`
-	DiskPercent       float64  `json:"disk_percent"`
-	NetRXBytes        int64    `json:"net_rx_bytes"`
-	NetTXBytes        int64    `json:"net_tx_bytes"`
-	TempCPU           *float64 `json:"temp_cpu"` // Pointer to allow null
-	UptimeSeconds     int64    `json:"uptime_seconds"`
-	Processes         int      `json:"processes"`
-	VMsRunning        int      `json:"vms_running"`
-	CTsRunning        int      `json:"cts_running"`
-	ContainersRunning int      `json:"containers_running"`
+	Timestamp          int64    `json:"timestamp"`
+	CPUPercent         float64  `json:"cpu_percent"`
+	Load1m             float64  `json:"load_1m"`
+	Load5m             float64  `json:"load_5m"`
+	Load15m            float64  `json:"load_15m"`
+	RAMUsedBytes       int64    `json:"ram_used_bytes"`
+	RAMAvailableBytes  int64    `json:"ram_available_bytes"`
+	RAMPercent         float64  `json:"ram_percent"`
+	SwapUsedBytes      int64    `json:"swap_used_bytes"`
+	DiskUsedBytes      int64    `json:"disk_used_bytes"`
+	DiskAvailableBytes int64    `json:"disk_available_bytes"`
+	DiskPercent        float64  `json:"disk_percent"`
+	NetRXBytes         int64    `json:"net_rx_bytes"`
+	NetTXBytes         int64    `json:"net_tx_bytes"`
+	TempCPU            *float64 `json:"temp_cpu"` // Pointer to allow null
+	UptimeSeconds      int64    `json:"uptime_seconds"`
+	Processes          int      `json:"processes"`
+	VMsRunning         int      `json:"vms_running"`
+	CTsRunning         int      `json:"cts_running"`
+	ContainersRunning  int      `json:"containers_running"`
+
+	// Detailed breakdowns
+	CPU         *CPUStats           `json:"cpu,omitempty"`
+	CPUFreq     *CPUFreqStats       `json:"cpu_freq,omitempty"`
+	Memory      *MemoryStats        `json:"memory,omitempty"`
+	Filesystems []FilesystemStats   `json:"filesystems,omitempty"`
+	DiskIO      []DiskIOStats       `json:"disk_io,omitempty"`
+	Network     []NetInterfaceStats `json:"network,omitempty"`
+	Pressure    *PSIStats           `json:"pressure,omitempty"`
+	Sensors     []SensorReading     `json:"sensors,omitempty"`
+	ProcStates  *ProcessStates      `json:"process_states,omitempty"`
+	TopProcs    *TopProcesses       `json:"top_processes,omitempty"`
+	Cgroups     []CgroupStats       `json:"cgroups,omitempty"`
+	Docker      *DockerStats        `json:"docker,omitempty"`
+	Proxmox     *ProxmoxStats       `json:"proxmox,omitempty"`
+	Systemd     *SystemdStats       `json:"systemd,omitempty"`
+	ZFS         *ZFSStats           `json:"zfs,omitempty"`
+	RAID        []MDArrayStats      `json:"raid,omitempty"`
+	LVM         *LVMStats           `json:"lvm,omitempty"`
+	SMART       []SMARTStats        `json:"smart,omitempty"`
+	Sockets     *SocketStats        `json:"sockets,omitempty"`
+	Listening   []ListeningSocket   `json:"listening"` // null when unchanged
+	Limits      *KernelLimits       `json:"limits,omitempty"`
+	Clock       *ClockStats         `json:"clock,omitempty"`
+	Updates     *UpdateStats        `json:"updates,omitempty"`
+	GPUs        []GPUStats          `json:"gpus,omitempty"`
 }
 
 // Collector gathers system metrics.
 type Collector struct {
 	mu           sync.Mutex
 	cpuCollector *CPUCollector
+	memCollector *MemoryCollector
+	cpuFreq      *CPUFreqCollector
+	fsCollector  *FilesystemCollector
+	ioCollector  *DiskIOCollector
+	netCollector *NetworkCollector
+	psiCollector *PSICollector
+	sensors      *SensorCollector
+	gpus         *GPUCollector
+	procs        *ProcessCollector
+	cgroups      *CgroupCollector
+	docker       *DockerCollector
+	proxmox      *ProxmoxCollector
+	systemd      *SystemdCollector
+	zfs          *ZFSCollector
+	mdraid       *MDRaidCollector
+	lvm          *LVMCollector
+	smart        *SMARTCollector
+	sockets      *SocketCollector
+	limits       *LimitsCollector
+	clock        *ClockCollector
+	updates      *UpdatesCollector
+	inventory    *InventoryCollector
+
+	// Events raised during collection, drained by Events()
+	events []Event
 }
 
 // New creates a new Collector instance.
-func New() *Collector {
+func New(cfg *config.Config) *Collector {
+	proxmox := NewProxmoxCollector(cfg.Proxmox)
+
 	return &Collector{
 		cpuCollector: NewCPUCollector(),
+		memCollector: NewMemoryCollector(),
+		cpuFreq:      NewCPUFreqCollector(),
+		fsCollector:  NewFilesystemCollector(cfg.Filesystems),
+		ioCollector:  NewDiskIOCollector(cfg.DiskIO),
+		netCollector: NewNetworkCollector(),
+		psiCollector: NewPSICollector(),
+		sensors:      NewSensorCollector(cfg.Sensors.CPUTemp),
+		gpus:         NewGPUCollector(),
+		procs:        NewProcessCollector(cfg.Processes),
+		cgroups:      NewCgroupCollector(cfg.Proxmox.CgroupPath),
+		docker:       NewDockerCollector(cfg.Docker.Socket),
+		proxmox:      proxmox,
+		systemd:      NewSystemdCollector(cfg.Systemd),
+		zfs:          NewZFSCollector(cfg.ZFS),
+		mdraid:       NewMDRaidCollector(),
+		lvm:          NewLVMCollector(cfg.LVM),
+		smart:        NewSMARTCollector(cfg.SMART),
+		sockets:      NewSocketCollector(),
+		limits:       NewLimitsCollector(),
+		clock:        NewClockCollector(),
+		updates:      NewUpdatesCollector(cfg.Updates),
+		inventory:    NewInventoryCollector(proxmox.IsProxmox, cfg.Docker.Socket),
 	}
 }
 
@@ -50,14 +127,17 @@ func (c *Collector) Collect() *Metrics {
 	defer c.mu.Unlock()
 
 	m := &Metrics{
-		Timestamp:         time.Now().Unix(),
-		VMsRunning:        0, // Only set by Proxmox hosts
-		CTsRunning:        0, // Only set by Proxmox hosts
-		ContainersRunning: 0, // Could be set by Docker hosts
+		Timestamp: time.Now().Unix(),
 	}
 
 	// CPU
-	m.CPUPercent = c.cpuCollector.Collect()
+	m.CPU = c.cpuCollector.Collect()
+	m.CPUPercent = m.CPU.UsagePercent
+
+	// CPU frequency and throttling
+	var freqEvents []Event
+	m.CPUFreq, freqEvents = c.cpuFreq.Collect()
+	c.queueEvents(freqEvents...)
 
 	// Load Average
 	load1, load5, load15 := CollectLoadAvg()
@@ -65,12 +145,20 @@ func (c *Collector) Collect() *Metrics {
 	m.Load5m = load5
 	m.Load15m = load15
 
+	// Pressure Stall Information
+	m.Pressure = c.psiCollector.Collect()
+
 	// Memory
-	memUsed, memAvail, memPercent, swapUsed := CollectMemory()
-	m.RAMUsedBytes = memUsed
-	m.RAMAvailableBytes = memAvail
-	m.RAMPercent = memPercent
-	m.SwapUsedBytes = swapUsed
+	var memEvents []Event
+	if m.Memory, memEvents = c.memCollector.Collect(); m.Memory != nil {
+		m.RAMUsedBytes = m.Memory.UsedBytes
+		m.RAMAvailableBytes = m.Memory.AvailableBytes
+		if m.Memory.TotalBytes > 0 {
+			m.RAMPercent = 100.0 * float64(m.Memory.UsedBytes) / float64(m.Memory.TotalBytes)
+		}
+		m.SwapUsedBytes = m.Memory.SwapUsedBytes
+	}
+	c.queueEvents(memEvents...)
 
 	// Disk
 	diskUsed, diskAvail, diskPercent := CollectDisk("/")
@@ -78,19 +166,102 @@ func (c *Collector) Collect() *Metrics {
 	m.DiskAvailableBytes = diskAvail
 	m.DiskPercent = diskPercent
 
+	// All other mounted filesystems
+	m.Filesystems = c.fsCollector.Collect()
+
+	// ZFS pools, datasets and ARC
+	m.ZFS = c.zfs.Collect()
+
+	// Software RAID
+	var raidEvents []Event
+	m.RAID, raidEvents = c.mdraid.Collect()
+	c.queueEvents(raidEvents...)
+
+	// LVM volume groups and thin pools
+	var lvmEvents []Event
+	m.LVM, lvmEvents = c.lvm.Collect()
+	c.queueEvents(lvmEvents...)
+
+	// SMART disk health
+	var smartEvents []Event
+	m.SMART, smartEvents = c.smart.Collect()
+	c.queueEvents(smartEvents...)
+
+	// Disk I/O
+	m.DiskIO = c.ioCollector.Collect()
+
 	// Network
-	m.NetRXBytes, m.NetTXBytes = CollectNetwork()
+	m.Network = c.netCollector.Collect()
+	m.NetRXBytes, m.NetTXBytes = sumPhysical(m.Network)
 
-	// Temperature
-	if temp, ok := CollectTemperature(); ok {
-		m.TempCPU = &temp
-	}
+	// Sockets and listening ports
+	m.Sockets, m.Listening = c.sockets.Collect()
+
+	// Kernel resource limits
+	m.Limits = c.limits.Collect()
+
+	// Temperature and other hardware sensors
+	m.Sensors, m.TempCPU = c.sensors.Collect()
+
+	// GPUs
+	m.GPUs = c.gpus.Collect()
+
+	// Clock synchronisation
+	var clockEvents []Event
+	m.Clock, clockEvents = c.clock.Collect()
+	c.queueEvents(clockEvents...)
+
+	// Pending package updates and reboot state
+	m.Updates = c.updates.Collect()
 
 	// Uptime
 	m.UptimeSeconds = CollectUptime()
 
 	// Processes
-	m.Processes = CollectProcesses()
+	m.ProcStates, m.TopProcs = c.procs.Collect()
+	m.Processes = m.ProcStates.Total
+
+	// Per-service and per-guest usage
+	m.Cgroups = c.cgroups.Collect()
+
+	// Proxmox guests, based on the cgroup and interface stats above
+	if m.Proxmox = c.proxmox.Collect(m.Cgroups, m.Network); m.Proxmox != nil {
+		m.VMsRunning = m.Proxmox.VMsRunning
+		m.CTsRunning = m.Proxmox.CTsRunning
+	}
+
+	// Docker
+	if m.Docker = c.docker.Collect(); m.Docker != nil {
+		m.ContainersRunning = m.Docker.States["running"]
+	}
+
+	// systemd units
+	m.Systemd = c.systemd.Collect()
 
 	return m
 }
+
+// MetricsSent records that the server received the metrics of a periodic
+// push, so change-only fields such as the listening sockets are not sent
+// again until they change.
+func (c *Collector) MetricsSent(m *Metrics) {
+	c.sockets.Sent(m.Listening)
+}
+
+// Inventory returns the static host inventory. Unless force is set, it
+// returns nil if the inventory did not change since it was last passed to
+// InventorySent.
+func (c *Collector) Inventory(force bool) *Inventory {
+	return c.inventory.Collect(force)
+}
+
+// InventorySent records that the server received an inventory.
+func (c *Collector) InventorySent(inv *Inventory) {
+	c.inventory.Sent(inv)
+}
+
+// TopProcesses samples all processes over about a second and returns the
+// top n by CPU and memory. n <= 0 uses the configured top_n.
+func (c *Collector) TopProcesses(n int) *TopProcesses {
+	return c.procs.Top(n)
+}
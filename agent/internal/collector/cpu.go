@@ -8,39 +8,82 @@ import (
 	"sync"
 )
 
+// CPUModes holds the share of CPU time spent in each mode during the last
+// sampling interval, in percent (0-100). The modes add up to 100.
+type CPUModes struct {
+	User    float64 `json:"user"`
+	Nice    float64 `json:"nice"`
+	System  float64 `json:"system"`
+	Idle    float64 `json:"idle"`
+	IOWait  float64 `json:"iowait"`
+	IRQ     float64 `json:"irq"`
+	SoftIRQ float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+	Guest   float64 `json:"guest"`
+}
+
+// CPUCoreStats holds the mode breakdown for a single core.
+type CPUCoreStats struct {
+	Core string `json:"core"`
+	CPUModes
+}
+
+// CPUStats holds the aggregate and per-core CPU breakdown.
+type CPUStats struct {
+	UsagePercent float64        `json:"usage_percent"`
+	Total        CPUModes       `json:"total"`
+	Cores        []CPUCoreStats `json:"cores"`
+}
+
+// cpuTimes holds the raw jiffy counters of one /proc/stat cpu line:
+// user nice system idle iowait irq softirq steal guest guest_nice
+type cpuTimes [10]uint64
+
 // CPUCollector tracks CPU usage between samples.
 type CPUCollector struct {
-	mu       sync.Mutex
-	prevIdle int64
-	prevTotal int64
+	mu   sync.Mutex
+	prev map[string]cpuTimes
 }
 
 // NewCPUCollector creates a new CPU collector.
 func NewCPUCollector() *CPUCollector {
 	c := &CPUCollector{}
 	// Take an initial reading to establish baseline
-	c.readCPUStat()
+	c.prev, _ = readCPUStat()
 	return c
 }
 
-// Collect returns the current CPU usage percentage (0-100).
-func (c *CPUCollector) Collect() float64 {
+// Collect returns the aggregate and per-core CPU usage since the last call.
+func (c *CPUCollector) Collect() *CPUStats {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	idle, total := c.readCPUStat()
+	cur, order := readCPUStat()
+	stats := &CPUStats{}
+	haveTotal := false
 
-	idleDelta := idle - c.prevIdle
-	totalDelta := total - c.prevTotal
+	for _, name := range order {
+		prev, ok := c.prev[name]
+		if !ok {
+			continue
+		}
+		modes, ok := cpuModes(prev, cur[name])
+		if name == "cpu" {
+			stats.Total = modes
+			haveTotal = ok
+			continue
+		}
+		stats.Cores = append(stats.Cores, CPUCoreStats{Core: name, CPUModes: modes})
+	}
 
-	c.prevIdle = idle
-	c.prevTotal = total
+	c.prev = cur
 
-	if totalDelta == 0 {
-		return 0
+	if !haveTotal {
+		return stats
 	}
 
-	usage := 100.0 * float64(totalDelta-idleDelta) / float64(totalDelta)
+	// Busy = everything except idle and iowait
+	usage := 100 - stats.Total.Idle - stats.Total.IOWait
 
 	// Clamp to valid range
 	if usage < 0 {
@@ -49,55 +92,102 @@ func (c *CPUCollector) Collect() float64 {
 	if usage > 100 {
 		usage = 100
 	}
+	stats.UsagePercent = usage
+
+	return stats
+}
+
+// cpuModes converts the counter delta between two samples into percentages.
+// It returns false if no time has passed between the samples.
+func cpuModes(prev, cur cpuTimes) (CPUModes, bool) {
+	var d cpuTimes
+	for i := range cur {
+		if cur[i] > prev[i] {
+			d[i] = cur[i] - prev[i]
+		}
+	}
+
+	// user and nice already include guest and guest_nice, so split them out
+	// to keep the modes summing up to 100.
+	user := sub(d[0], d[8])
+	nice := sub(d[1], d[9])
+	guest := d[8] + d[9]
+
+	total := user + nice + guest
+	for i := 2; i <= 7; i++ {
+		total += d[i]
+	}
+	if total == 0 {
+		return CPUModes{}, false
+	}
 
-	return usage
+	pct := func(v uint64) float64 {
+		return 100.0 * float64(v) / float64(total)
+	}
+
+	return CPUModes{
+		User:    pct(user),
+		Nice:    pct(nice),
+		System:  pct(d[2]),
+		Idle:    pct(d[3]),
+		IOWait:  pct(d[4]),
+		IRQ:     pct(d[5]),
+		SoftIRQ: pct(d[6]),
+		Steal:   pct(d[7]),
+		Guest:   pct(guest),
+	}, true
 }
 
-// readCPUStat reads /proc/stat and returns idle time and total time.
-func (c *CPUCollector) readCPUStat() (idle, total int64) {
+// sub returns a-b, or 0 if b is larger.
+func sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// readCPUStat reads all cpu lines from /proc/stat. It returns the counters
+// keyed by name ("cpu", "cpu0", ...) and the names in file order.
+func readCPUStat() (map[string]cpuTimes, []string) {
+	times := make(map[string]cpuTimes)
+	var order []string
+
 	file, err := os.Open("/proc/stat")
 	if err != nil {
-		return 0, 0
+		return times, order
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, "cpu ") {
-			fields := strings.Fields(line)
-			if len(fields) < 5 {
-				return 0, 0
-			}
-
-			// Fields: cpu user nice system idle iowait irq softirq steal guest guest_nice
-			// We need: user(1), nice(2), system(3), idle(4), iowait(5), irq(6), softirq(7), steal(8)
-
-			var values []int64
-			for i := 1; i < len(fields) && i <= 8; i++ {
-				v, err := strconv.ParseInt(fields[i], 10, 64)
-				if err != nil {
-					v = 0
-				}
-				values = append(values, v)
-			}
-
-			// Ensure we have at least 4 values
-			for len(values) < 8 {
-				values = append(values, 0)
+		if !strings.HasPrefix(line, "cpu") {
+			// cpu lines come first, so we are done
+			if len(order) > 0 {
+				break
 			}
+			continue
+		}
 
-			// idle = idle + iowait
-			idle = values[3] + values[4]
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
 
-			// total = sum of all values
-			for _, v := range values {
-				total += v
+		// Fields: cpu user nice system idle iowait irq softirq steal guest guest_nice
+		// Older kernels omit the trailing fields, those stay 0.
+		var t cpuTimes
+		for i := 1; i < len(fields) && i <= len(t); i++ {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				v = 0
 			}
-
-			return idle, total
+			t[i-1] = v
 		}
+
+		times[fields[0]] = t
+		order = append(order, fields[0])
 	}
 
-	return 0, 0
+	return times, order
 }
@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EventCPUThrottled is raised when the Raspberry Pi throttle flags change
+// or the x86 thermal throttle counters increase.
+const EventCPUThrottled = "cpu_throttled"
+
+// Raspberry Pi get_throttled bits. The low bits are the current state,
+// the same bits shifted by 16 are sticky since boot.
+const (
+	piUnderVoltage  = 1 << 0
+	piFreqCapped    = 1 << 1
+	piThrottled     = 1 << 2
+	piSoftTempLimit = 1 << 3
+	piStickyShift   = 16
+)
+
+// CPUFreqCore holds the frequency scaling state of one core. The throttle
+// counters are only available on x86 (thermal_throttle).
+type CPUFreqCore struct {
+	Core                 string  `json:"core"`
+	CurMHz               float64 `json:"cur_mhz"`
+	MinMHz               float64 `json:"min_mhz"`
+	MaxMHz               float64 `json:"max_mhz"`
+	Governor             string  `json:"governor,omitempty"`
+	CoreThrottleCount    int64   `json:"core_throttle_count,omitempty"`
+	PackageThrottleCount int64   `json:"package_throttle_count,omitempty"`
+}
+
+// PiThrottleFlags decodes the Raspberry Pi firmware get_throttled value.
+// The *Occurred flags are sticky until reboot.
+type PiThrottleFlags struct {
+	Raw                   uint32 `json:"raw"`
+	UnderVoltage          bool   `json:"under_voltage"`
+	FreqCapped            bool   `json:"freq_capped"`
+	Throttled             bool   `json:"throttled"`
+	SoftTempLimit         bool   `json:"soft_temp_limit"`
+	UnderVoltageOccurred  bool   `json:"under_voltage_occurred"`
+	FreqCappedOccurred    bool   `json:"freq_capped_occurred"`
+	ThrottledOccurred     bool   `json:"throttled_occurred"`
+	SoftTempLimitOccurred bool   `json:"soft_temp_limit_occurred"`
+}
+
+// newPiThrottleFlags decodes a get_throttled value.
+func newPiThrottleFlags(raw uint32) *PiThrottleFlags {
+	sticky := raw >> piStickyShift
+	return &PiThrottleFlags{
+		Raw:                   raw,
+		UnderVoltage:          raw&piUnderVoltage != 0,
+		FreqCapped:            raw&piFreqCapped != 0,
+		Throttled:             raw&piThrottled != 0,
+		SoftTempLimit:         raw&piSoftTempLimit != 0,
+		UnderVoltageOccurred:  sticky&piUnderVoltage != 0,
+		FreqCappedOccurred:    sticky&piFreqCapped != 0,
+		ThrottledOccurred:     sticky&piThrottled != 0,
+		SoftTempLimitOccurred: sticky&piSoftTempLimit != 0,
+	}
+}
+
+// CPUFreqStats holds per-core frequencies and throttle state.
+type CPUFreqStats struct {
+	Cores       []CPUFreqCore    `json:"cores"`
+	PiThrottled *PiThrottleFlags `json:"pi_throttled,omitempty"`
+}
+
+// CPUFreqCollector reads cpufreq, thermal_throttle and the Raspberry Pi
+// firmware throttle state.
+type CPUFreqCollector struct {
+	mu            sync.Mutex
+	sysCPUPath    string
+	firmwarePath  string
+	run           CommandRunner
+	noVcgencmd    bool
+	prevPi        *PiThrottleFlags
+	prevThrottles int64
+	throttlesSeen bool
+}
+
+// NewCPUFreqCollector creates a new CPU frequency collector.
+func NewCPUFreqCollector() *CPUFreqCollector {
+	return &CPUFreqCollector{
+		sysCPUPath:   "/sys/devices/system/cpu",
+		firmwarePath: "/sys/devices/platform/soc/soc:firmware",
+		run:          runCommand,
+	}
+}
+
+// Collect returns the frequency and throttle state and a cpu_throttled
+// event if it changed. Throttle flags already set when first read (e.g.
+// under-voltage since boot) raise the event too. It returns nil if neither
+// cpufreq nor the Pi firmware interface is available.
+func (f *CPUFreqCollector) Collect() (*CPUFreqStats, []Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := &CPUFreqStats{}
+	var throttles int64
+
+	dirs, _ := filepath.Glob(filepath.Join(f.sysCPUPath, "cpu[0-9]*"))
+	sort.Slice(dirs, func(i, j int) bool { return cpuIndex(dirs[i]) < cpuIndex(dirs[j]) })
+
+	for _, dir := range dirs {
+		core := CPUFreqCore{Core: filepath.Base(dir)}
+		hasFreq := false
+
+		if khz, ok := readInt(filepath.Join(dir, "cpufreq", "scaling_cur_freq")); ok {
+			hasFreq = true
+			core.CurMHz = float64(khz) / 1000
+		}
+		if khz, ok := readInt(filepath.Join(dir, "cpufreq", "scaling_min_freq")); ok {
+			core.MinMHz = float64(khz) / 1000
+		}
+		if khz, ok := readInt(filepath.Join(dir, "cpufreq", "scaling_max_freq")); ok {
+			core.MaxMHz = float64(khz) / 1000
+		}
+		core.Governor = readString(filepath.Join(dir, "cpufreq", "scaling_governor"))
+
+		core.CoreThrottleCount, _ = readInt(filepath.Join(dir, "thermal_throttle", "core_throttle_count"))
+		core.PackageThrottleCount, _ = readInt(filepath.Join(dir, "thermal_throttle", "package_throttle_count"))
+		throttles += core.CoreThrottleCount
+
+		if hasFreq || core.CoreThrottleCount > 0 {
+			stats.Cores = append(stats.Cores, core)
+		}
+	}
+
+	if raw, ok := f.readPiThrottled(); ok {
+		stats.PiThrottled = newPiThrottleFlags(raw)
+	}
+
+	if len(stats.Cores) == 0 && stats.PiThrottled == nil {
+		return nil, nil
+	}
+
+	var events []Event
+
+	if pi := stats.PiThrottled; pi != nil {
+		var prevRaw uint32
+		if f.prevPi != nil {
+			prevRaw = f.prevPi.Raw
+		}
+		if pi.Raw != prevRaw {
+			events = append(events, newEvent(EventCPUThrottled, map[string]interface{}{
+				"source":       "raspberry_pi",
+				"raw":          pi.Raw,
+				"previous_raw": prevRaw,
+				"flags":        pi,
+			}))
+		}
+		f.prevPi = pi
+	}
+
+	// The counters are cumulative since boot, the first reading is the baseline
+	if f.throttlesSeen && throttles > f.prevThrottles {
+		events = append(events, newEvent(EventCPUThrottled, map[string]interface{}{
+			"source": "thermal",
+			"count":  throttles - f.prevThrottles,
+			"total":  throttles,
+		}))
+	}
+	f.prevThrottles = throttles
+	f.throttlesSeen = true
+
+	return stats, events
+}
+
+// readPiThrottled reads the firmware throttle state from sysfs, or from
+// vcgencmd on kernels without the sysfs attribute.
+func (f *CPUFreqCollector) readPiThrottled() (uint32, bool) {
+	// sysfs prints the value in hex without prefix
+	if s := readString(filepath.Join(f.firmwarePath, "get_throttled")); s != "" {
+		v, err := strconv.ParseUint(s, 16, 32)
+		return uint32(v), err == nil
+	}
+
+	if f.noVcgencmd {
+		return 0, false
+	}
+
+	// Output: throttled=0x50005
+	out, err := f.run("vcgencmd", "get_throttled")
+	if err != nil {
+		f.noVcgencmd = true
+		return 0, false
+	}
+	_, value, ok := strings.Cut(strings.TrimSpace(string(out)), "=")
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 32)
+	return uint32(v), err == nil
+}
+
+// cpuIndex returns the number of a "cpuN" directory for sorting.
+func cpuIndex(dir string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "cpu"))
+	return n
+}
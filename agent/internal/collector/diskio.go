@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// sectorSize is the unit /proc/diskstats uses for sector counts,
+// independent of the device's real sector size.
+const sectorSize = 512
+
+// virtualDisks are the name prefixes of RAM-backed and loop devices, which
+// are skipped unless included explicitly.
+var virtualDisks = []string{"loop", "ram", "zram"}
+
+// DiskIOStats holds I/O rates for a single block device over the last interval.
+type DiskIOStats struct {
+	Device           string  `json:"device"`
+	Name             string  `json:"name"` // LVM name for dm-* devices, otherwise same as Device
+	ReadIOPS         float64 `json:"read_iops"`
+	WriteIOPS        float64 `json:"write_iops"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadAwaitMs      float64 `json:"read_await_ms"`
+	WriteAwaitMs     float64 `json:"write_await_ms"`
+	AwaitMs          float64 `json:"await_ms"`
+	QueueDepth       float64 `json:"queue_depth"`
+	InFlight         int64   `json:"in_flight"`
+	UtilPercent      float64 `json:"util_percent"`
+}
+
+// diskCounters holds the raw counters of one /proc/diskstats line.
+type diskCounters struct {
+	reads, readSectors, readMs    uint64
+	writes, writeSectors, writeMs uint64
+	inFlight                      int64
+	ioMs, weightedMs              uint64
+}
+
+// DiskIOCollector tracks block device I/O between samples.
+type DiskIOCollector struct {
+	mu            sync.Mutex
+	diskstatsPath string
+	sysBlockPath  string
+	cfg           config.DiskIOConfig
+	prev          map[string]diskCounters
+	prevTime      time.Time
+}
+
+// NewDiskIOCollector creates a new disk I/O collector.
+func NewDiskIOCollector(cfg config.DiskIOConfig) *DiskIOCollector {
+	d := &DiskIOCollector{
+		diskstatsPath: "/proc/diskstats",
+		sysBlockPath:  "/sys/block",
+		cfg:           cfg,
+	}
+	// Take an initial reading to establish baseline
+	d.prev, _ = readDiskStats(d.diskstatsPath)
+	d.prevTime = time.Now()
+	return d
+}
+
+// Collect returns per-device I/O rates since the last call.
+func (d *DiskIOCollector) Collect() []DiskIOStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cur, order := readDiskStats(d.diskstatsPath)
+	now := time.Now()
+	elapsed := now.Sub(d.prevTime).Seconds()
+
+	var result []DiskIOStats
+	if elapsed > 0 {
+		for _, dev := range order {
+			prev, ok := d.prev[dev]
+			if !ok || !d.wanted(dev) {
+				continue
+			}
+			s := diskIORates(prev, cur[dev], elapsed)
+			s.Device = dev
+			s.Name = d.deviceName(dev)
+			result = append(result, s)
+		}
+	}
+
+	d.prev = cur
+	d.prevTime = now
+
+	return result
+}
+
+// wanted applies the device filters and skips partitions.
+func (d *DiskIOCollector) wanted(dev string) bool {
+	if matchAny(d.cfg.ExcludeDevices, dev) {
+		return false
+	}
+	if len(d.cfg.IncludeDevices) > 0 {
+		if !matchAny(d.cfg.IncludeDevices, dev) {
+			return false
+		}
+	} else {
+		for _, prefix := range virtualDisks {
+			if strings.HasPrefix(dev, prefix) {
+				return false
+			}
+		}
+	}
+
+	// Only whole disks have an entry in /sys/block
+	if !d.cfg.IncludePartitions {
+		if !fileExists(filepath.Join(d.sysBlockPath, dev)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// deviceName maps device-mapper devices to their LVM/dm name.
+func (d *DiskIOCollector) deviceName(dev string) string {
+	if !strings.HasPrefix(dev, "dm-") {
+		return dev
+	}
+	if name := readString(filepath.Join(d.sysBlockPath, dev, "dm", "name")); name != "" {
+		return name
+	}
+	return dev
+}
+
+// diskIORates converts two counter samples into per-second rates.
+func diskIORates(prev, cur diskCounters, elapsed float64) DiskIOStats {
+	reads := float64(sub(cur.reads, prev.reads))
+	writes := float64(sub(cur.writes, prev.writes))
+	readMs := float64(sub(cur.readMs, prev.readMs))
+	writeMs := float64(sub(cur.writeMs, prev.writeMs))
+
+	s := DiskIOStats{
+		ReadIOPS:         reads / elapsed,
+		WriteIOPS:        writes / elapsed,
+		ReadBytesPerSec:  float64(sub(cur.readSectors, prev.readSectors)) * sectorSize / elapsed,
+		WriteBytesPerSec: float64(sub(cur.writeSectors, prev.writeSectors)) * sectorSize / elapsed,
+		QueueDepth:       float64(sub(cur.weightedMs, prev.weightedMs)) / (elapsed * 1000),
+		InFlight:         cur.inFlight,
+		UtilPercent:      100.0 * float64(sub(cur.ioMs, prev.ioMs)) / (elapsed * 1000),
+	}
+
+	// Average time per request, like the await columns of iostat -x
+	if reads > 0 {
+		s.ReadAwaitMs = readMs / reads
+	}
+	if writes > 0 {
+		s.WriteAwaitMs = writeMs / writes
+	}
+	if reads+writes > 0 {
+		s.AwaitMs = (readMs + writeMs) / (reads + writes)
+	}
+
+	if s.UtilPercent > 100 {
+		s.UtilPercent = 100
+	}
+
+	return s
+}
+
+// readDiskStats parses /proc/diskstats. It returns the counters keyed by
+// device name and the device names in file order.
+func readDiskStats(filename string) (map[string]diskCounters, []string) {
+	stats := make(map[string]diskCounters)
+	var order []string
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return stats, order
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Format: major minor name reads reads_merged sectors_read ms_reading
+		//         writes writes_merged sectors_written ms_writing
+		//         in_flight ms_io weighted_ms_io [discard and flush fields]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+
+		v := make([]uint64, 11)
+		for i := range v {
+			v[i], _ = strconv.ParseUint(fields[i+3], 10, 64)
+		}
+
+		name := fields[2]
+		stats[name] = diskCounters{
+			reads:        v[0],
+			readSectors:  v[2],
+			readMs:       v[3],
+			writes:       v[4],
+			writeSectors: v[6],
+			writeMs:      v[7],
+			inFlight:     int64(v[8]),
+			ioMs:         v[9],
+			weightedMs:   v[10],
+		}
+		order = append(order, name)
+	}
+
+	return stats, order
+}
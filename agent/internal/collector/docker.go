@@ -0,0 +1,298 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerTimeout limits each Docker API request and the whole collection,
+// so a slow daemon cannot stall the metric push.
+const dockerTimeout = 5 * time.Second
+
+// dockerInspectInterval is how often restart count and health of a
+// container are inspected again while its state does not change.
+const dockerInspectInterval = 60 * time.Second
+
+// ContainerStats describes a single container.
+type ContainerStats struct {
+	ID               string  `json:"id"`
+	Name             string  `json:"name"`
+	Image            string  `json:"image"`
+	State            string  `json:"state"`  // running, exited, paused, ...
+	Status           string  `json:"status"` // e.g. "Up 2 hours (healthy)"
+	Health           string  `json:"health,omitempty"`
+	RestartCount     int     `json:"restart_count"`
+	CPUPercent       float64 `json:"cpu_percent"` // 100 = one full core
+	MemoryBytes      int64   `json:"memory_bytes"`
+	MemoryLimitBytes int64   `json:"memory_limit_bytes"`
+	MemoryPercent    float64 `json:"memory_percent"`
+	NetRXBytes       int64   `json:"net_rx_bytes"`
+	NetTXBytes       int64   `json:"net_tx_bytes"`
+	BlockReadBytes   int64   `json:"block_read_bytes"`
+	BlockWriteBytes  int64   `json:"block_write_bytes"`
+}
+
+// DockerStats holds container counts by state and per-container details.
+type DockerStats struct {
+	States     map[string]int   `json:"states"`
+	Containers []ContainerStats `json:"containers"`
+}
+
+// Docker Engine API response types, reduced to the fields we use.
+type dockerContainer struct {
+	ID     string   `json:"Id"`
+	Names  []string `json:"Names"`
+	Image  string   `json:"Image"`
+	State  string   `json:"State"`
+	Status string   `json:"Status"`
+}
+
+type dockerInspect struct {
+	RestartCount int `json:"RestartCount"`
+	State        struct {
+		Health *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+type dockerStatsResponse struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  int    `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage int64            `json:"usage"`
+		Limit int64            `json:"limit"`
+		Stats map[string]int64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes int64 `json:"rx_bytes"`
+		TxBytes int64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value int64  `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+}
+
+// dockerInspected is the cached inspect data of a container.
+type dockerInspected struct {
+	state        string
+	restartCount int
+	health       string
+	time         time.Time
+}
+
+// dockerCPU is the CPU counter pair needed for the CPU percentage.
+type dockerCPU struct {
+	container, system uint64
+}
+
+// DockerCollector talks to the Docker Engine API over its unix socket.
+type DockerCollector struct {
+	mu        sync.Mutex
+	socket    string
+	client    *http.Client
+	prev      map[string]dockerCPU
+	inspected map[string]dockerInspected
+}
+
+// NewDockerCollector creates a Docker collector for the given socket path.
+func NewDockerCollector(socket string) *DockerCollector {
+	return &DockerCollector{
+		socket: socket,
+		client: &http.Client{
+			Timeout: dockerTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		prev:      make(map[string]dockerCPU),
+		inspected: make(map[string]dockerInspected),
+	}
+}
+
+// Collect returns container counts and stats. It returns nil if there is no
+// Docker socket or the daemon does not answer.
+func (d *DockerCollector) Collect() *DockerStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.socket == "" || !fileExists(d.socket) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerTimeout)
+	defer cancel()
+
+	var containers []dockerContainer
+	if err := d.get(ctx, "/containers/json?all=1", &containers); err != nil {
+		return nil
+	}
+
+	// Daemons before API 1.41 ignore one-shot and sample for 1-2 seconds,
+	// so the stats of all containers are fetched concurrently
+	responses := make([]*dockerStatsResponse, len(containers))
+	var wg sync.WaitGroup
+	for i, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			var s dockerStatsResponse
+			if err := d.get(ctx, "/containers/"+id+"/stats?stream=false&one-shot=true", &s); err == nil {
+				responses[i] = &s
+			}
+		}(i, c.ID)
+	}
+
+	stats := &DockerStats{States: make(map[string]int)}
+	cur := make(map[string]dockerCPU)
+	inspected := make(map[string]dockerInspected, len(containers))
+
+	for _, c := range containers {
+		stats.States[c.State]++
+
+		cs := ContainerStats{
+			ID:     shortID(c.ID),
+			Image:  c.Image,
+			State:  c.State,
+			Status: c.Status,
+		}
+		if len(c.Names) > 0 {
+			cs.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		info := d.inspect(ctx, c)
+		inspected[c.ID] = info
+		cs.RestartCount = info.restartCount
+		cs.Health = info.health
+
+		stats.Containers = append(stats.Containers, cs)
+	}
+
+	wg.Wait()
+	for i, s := range responses {
+		if s != nil {
+			d.applyStats(containers[i].ID, s, &stats.Containers[i], cur)
+		}
+	}
+
+	d.prev = cur
+	d.inspected = inspected
+
+	return stats
+}
+
+// inspect returns restart count and health of a container, inspecting it
+// again when its state changed or the cached data is older than
+// dockerInspectInterval.
+func (d *DockerCollector) inspect(ctx context.Context, c dockerContainer) dockerInspected {
+	if info, ok := d.inspected[c.ID]; ok && info.state == c.State && time.Since(info.time) < dockerInspectInterval {
+		return info
+	}
+
+	var inspect dockerInspect
+	if err := d.get(ctx, "/containers/"+c.ID+"/json", &inspect); err != nil {
+		// Keep the old data, the state check retries next time
+		info := d.inspected[c.ID]
+		info.state = ""
+		return info
+	}
+
+	info := dockerInspected{
+		state:        c.State,
+		restartCount: inspect.RestartCount,
+		time:         time.Now(),
+	}
+	if inspect.State.Health != nil {
+		info.health = inspect.State.Health.Status
+	}
+	return info
+}
+
+// applyStats fills in resource usage of a running container. The one-shot
+// mode returns immediately instead of sampling for a second, so the CPU
+// percentage is computed against our own previous sample.
+func (d *DockerCollector) applyStats(id string, s *dockerStatsResponse, cs *ContainerStats, cur map[string]dockerCPU) {
+	cpu := dockerCPU{
+		container: s.CPUStats.CPUUsage.TotalUsage,
+		system:    s.CPUStats.SystemUsage,
+	}
+	cur[id] = cpu
+
+	if prev, ok := d.prev[id]; ok {
+		cpuDelta := sub(cpu.container, prev.container)
+		systemDelta := sub(cpu.system, prev.system)
+		if systemDelta > 0 {
+			cpus := s.CPUStats.OnlineCPUs
+			if cpus == 0 {
+				cpus = 1
+			}
+			cs.CPUPercent = 100.0 * float64(cpuDelta) / float64(systemDelta) * float64(cpus)
+		}
+	}
+
+	// Same as `docker stats`: page cache is not counted as used memory
+	cs.MemoryBytes = s.MemoryStats.Usage
+	if cache, ok := s.MemoryStats.Stats["total_inactive_file"]; ok { // cgroup v1
+		cs.MemoryBytes -= cache
+	} else if cache, ok := s.MemoryStats.Stats["inactive_file"]; ok { // cgroup v2
+		cs.MemoryBytes -= cache
+	}
+	cs.MemoryLimitBytes = s.MemoryStats.Limit
+	if cs.MemoryLimitBytes > 0 {
+		cs.MemoryPercent = 100.0 * float64(cs.MemoryBytes) / float64(cs.MemoryLimitBytes)
+	}
+
+	for _, n := range s.Networks {
+		cs.NetRXBytes += n.RxBytes
+		cs.NetTXBytes += n.TxBytes
+	}
+
+	for _, b := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(b.Op) {
+		case "read":
+			cs.BlockReadBytes += b.Value
+		case "write":
+			cs.BlockWriteBytes += b.Value
+		}
+	}
+}
+
+// get performs a GET request against the Docker API and decodes the JSON body.
+func (d *DockerCollector) get(ctx context.Context, path string, v interface{}) error {
+	// The host part is ignored, the transport always dials the socket
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("docker api %s: %s", path, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
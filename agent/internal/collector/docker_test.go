@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeDockerAPI serves a running and an exited container over a unix
+// socket and returns the socket path and the number of inspect calls.
+func fakeDockerAPI(t *testing.T) (string, *int32) {
+	t.Helper()
+
+	var inspects int32
+	var cpuUsage uint64
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"Id": "aaaaaaaaaaaa1111", "Names": ["/web"], "Image": "nginx", "State": "running", "Status": "Up 2 hours (healthy)"},
+			{"Id": "bbbbbbbbbbbb2222", "Names": ["/job"], "Image": "busybox", "State": "exited", "Status": "Exited (0) 1 hour ago"}
+		]`)
+	})
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/json"):
+			atomic.AddInt32(&inspects, 1)
+			if strings.Contains(r.URL.Path, "aaaa") {
+				fmt.Fprint(w, `{"RestartCount": 3, "State": {"Health": {"Status": "healthy"}}}`)
+			} else {
+				fmt.Fprint(w, `{"RestartCount": 0, "State": {}}`)
+			}
+		case strings.HasSuffix(r.URL.Path, "/stats"):
+			if r.URL.Query().Get("one-shot") != "true" {
+				t.Errorf("stats request without one-shot: %s", r.URL)
+			}
+			// Each call adds 0.5 s container time per 2 s system time
+			usage := atomic.AddUint64(&cpuUsage, 500000000)
+			fmt.Fprintf(w, `{
+				"cpu_stats": {"cpu_usage": {"total_usage": %d}, "system_cpu_usage": %d, "online_cpus": 4},
+				"memory_stats": {"usage": 300, "limit": 1000, "stats": {"inactive_file": 100}},
+				"networks": {"eth0": {"rx_bytes": 10, "tx_bytes": 20}, "eth1": {"rx_bytes": 1, "tx_bytes": 2}},
+				"blkio_stats": {"io_service_bytes_recursive": [{"op": "read", "value": 7}, {"op": "Write", "value": 9}]}
+			}`, usage, usage*4)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Listener = listener
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return socket, &inspects
+}
+
+func TestDockerCollect(t *testing.T) {
+	socket, inspects := fakeDockerAPI(t)
+	d := NewDockerCollector(socket)
+
+	// The first collection is the CPU baseline
+	if stats := d.Collect(); stats == nil {
+		t.Fatal("Collect returned nil")
+	}
+	stats := d.Collect()
+	if stats == nil {
+		t.Fatal("Collect returned nil")
+	}
+
+	if stats.States["running"] != 1 || stats.States["exited"] != 1 {
+		t.Errorf("states = %v", stats.States)
+	}
+	if len(stats.Containers) != 2 {
+		t.Fatalf("got %d containers", len(stats.Containers))
+	}
+
+	web := stats.Containers[0]
+	if web.ID != "aaaaaaaaaaaa" || web.Name != "web" || web.Health != "healthy" || web.RestartCount != 3 {
+		t.Errorf("web = %+v", web)
+	}
+	// 0.5 s of 2 s system time on 4 CPUs is one full core
+	if web.CPUPercent != 100 {
+		t.Errorf("web CPUPercent = %v, want 100", web.CPUPercent)
+	}
+	if web.MemoryBytes != 200 || web.MemoryPercent != 20 {
+		t.Errorf("web memory = %d (%v%%), want 200 (20%%)", web.MemoryBytes, web.MemoryPercent)
+	}
+	if web.NetRXBytes != 11 || web.NetTXBytes != 22 || web.BlockReadBytes != 7 || web.BlockWriteBytes != 9 {
+		t.Errorf("web I/O = %+v", web)
+	}
+
+	job := stats.Containers[1]
+	if job.Name != "job" || job.CPUPercent != 0 || job.MemoryBytes != 0 {
+		t.Errorf("job = %+v", job)
+	}
+
+	// Inspect data is cached while the state does not change
+	if n := atomic.LoadInt32(inspects); n != 2 {
+		t.Errorf("inspected %d times, want 2", n)
+	}
+}
+
+func TestDockerCollectNoSocket(t *testing.T) {
+	d := NewDockerCollector(filepath.Join(t.TempDir(), "missing.sock"))
+	if stats := d.Collect(); stats != nil {
+		t.Errorf("Collect = %+v, want nil", stats)
+	}
+}
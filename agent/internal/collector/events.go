@@ -0,0 +1,52 @@
+package collector
+
+import "time"
+
+// maxQueuedEvents bounds the event queue while events keep failing to send
+// and are requeued. The oldest events are dropped.
+const maxQueuedEvents = 100
+
+// Event is a state change worth telling the server about immediately, such
+// as a degraded RAID array. Type is sent as the "event" field of the event
+// message, Data as its payload.
+type Event struct {
+	Type string
+	Data map[string]interface{}
+}
+
+// newEvent creates an event. The current time is added to the data as
+// "timestamp" since events may be sent up to a push interval later.
+func newEvent(eventType string, data map[string]interface{}) Event {
+	data["timestamp"] = time.Now().Unix()
+	return Event{Type: eventType, Data: data}
+}
+
+// queueEvents appends events to the queue. Must be called with c.mu held.
+func (c *Collector) queueEvents(events ...Event) {
+	c.events = append(c.events, events...)
+	if len(c.events) > maxQueuedEvents {
+		c.events = c.events[len(c.events)-maxQueuedEvents:]
+	}
+}
+
+// Requeue puts events that failed to send back in front of the queue so
+// they are sent, in order, with the next push.
+func (c *Collector) Requeue(events ...Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.events = append(append([]Event(nil), events...), c.events...)
+	if len(c.events) > maxQueuedEvents {
+		c.events = c.events[len(c.events)-maxQueuedEvents:]
+	}
+}
+
+// Events returns and clears the events raised since the last call.
+func (c *Collector) Events() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	events := c.events
+	c.events = nil
+	return events
+}
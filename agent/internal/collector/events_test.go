@@ -0,0 +1,30 @@
+package collector
+
+import "testing"
+
+func TestRequeue(t *testing.T) {
+	c := &Collector{}
+	c.queueEvents(Event{Type: "new"})
+
+	// Unsent events go before the ones raised in the meantime
+	c.Requeue(Event{Type: "old1"}, Event{Type: "old2"})
+	events := c.Events()
+	if len(events) != 3 || events[0].Type != "old1" || events[1].Type != "old2" || events[2].Type != "new" {
+		t.Errorf("events = %+v", events)
+	}
+	if events := c.Events(); len(events) != 0 {
+		t.Errorf("queue not drained: %+v", events)
+	}
+
+	// The oldest events are dropped beyond maxQueuedEvents
+	failed := make([]Event, maxQueuedEvents)
+	for i := range failed {
+		failed[i] = Event{Type: "failed"}
+	}
+	c.queueEvents(Event{Type: "new"})
+	c.Requeue(failed...)
+	events = c.Events()
+	if len(events) != maxQueuedEvents || events[len(events)-1].Type != "new" {
+		t.Errorf("got %d events, last %+v", len(events), events[len(events)-1])
+	}
+}
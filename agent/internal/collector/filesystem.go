@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// FilesystemStats holds usage figures for a single mounted filesystem.
+type FilesystemStats struct {
+	Mountpoint     string  `json:"mountpoint"`
+	Device         string  `json:"device"`
+	FSType         string  `json:"fs_type"`
+	SizeBytes      int64   `json:"size_bytes"`
+	UsedBytes      int64   `json:"used_bytes"`
+	AvailableBytes int64   `json:"available_bytes"`
+	Percent        float64 `json:"percent"`
+	InodesTotal    int64   `json:"inodes_total"`
+	InodesUsed     int64   `json:"inodes_used"`
+	InodesFree     int64   `json:"inodes_free"`
+	InodesPercent  float64 `json:"inodes_percent"`
+}
+
+// ignoredFSTypes are pseudo, virtual and network filesystems that are skipped
+// unless explicitly listed in include_fs_types. Network filesystems are on this
+// list because statfs on a dead server blocks the whole collection cycle.
+var ignoredFSTypes = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true,
+	"cgroup2": true, "configfs": true, "debugfs": true, "devpts": true,
+	"devtmpfs": true, "efivarfs": true, "fuse.lxcfs": true, "fusectl": true,
+	"hugetlbfs": true, "mqueue": true, "nsfs": true, "overlay": true,
+	"proc": true, "pstore": true, "ramfs": true, "rpc_pipefs": true,
+	"securityfs": true, "squashfs": true, "sysfs": true, "tmpfs": true,
+	"tracefs": true, "fuse.gvfsd-fuse": true, "fuse.portal": true,
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "fuse.sshfs": true,
+}
+
+// mountInfo is one parsed line of /proc/self/mountinfo.
+type mountInfo struct {
+	device     string // major:minor
+	mountpoint string
+	fsType     string
+	source     string
+}
+
+// FilesystemCollector reports usage for every real mounted filesystem.
+type FilesystemCollector struct {
+	mountinfoPath string
+	cfg           config.FilesystemConfig
+}
+
+// NewFilesystemCollector creates a filesystem collector using the given filters.
+func NewFilesystemCollector(cfg config.FilesystemConfig) *FilesystemCollector {
+	return &FilesystemCollector{
+		mountinfoPath: "/proc/self/mountinfo",
+		cfg:           cfg,
+	}
+}
+
+// Collect returns usage for all mounts that pass the configured filters.
+// Bind mounts and other mounts of an already seen device are skipped.
+func (f *FilesystemCollector) Collect() []FilesystemStats {
+	mounts := readMountInfo(f.mountinfoPath)
+
+	var result []FilesystemStats
+	seen := make(map[string]bool)
+
+	for _, m := range mounts {
+		if !f.wanted(m) {
+			continue
+		}
+		if seen[m.device] {
+			continue
+		}
+
+		stats, ok := statFilesystem(m.mountpoint)
+		if !ok {
+			continue
+		}
+		seen[m.device] = true
+
+		stats.Device = m.source
+		stats.FSType = m.fsType
+		result = append(result, stats)
+	}
+
+	return result
+}
+
+// wanted applies the fs type and mountpoint filters.
+func (f *FilesystemCollector) wanted(m mountInfo) bool {
+	if matchAny(f.cfg.ExcludeFSTypes, m.fsType) {
+		return false
+	}
+	if len(f.cfg.IncludeFSTypes) > 0 {
+		if !matchAny(f.cfg.IncludeFSTypes, m.fsType) {
+			return false
+		}
+	} else if ignoredFSTypes[m.fsType] {
+		return false
+	}
+
+	if matchAny(f.cfg.ExcludeMountpoints, m.mountpoint) {
+		return false
+	}
+	if len(f.cfg.IncludeMountpoints) > 0 && !matchAny(f.cfg.IncludeMountpoints, m.mountpoint) {
+		return false
+	}
+
+	return true
+}
+
+// matchAny reports whether s matches any of the given path.Match patterns.
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// statFilesystem calls statfs on the mountpoint and fills in the usage figures.
+func statFilesystem(mountpoint string) (FilesystemStats, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountpoint, &stat); err != nil {
+		return FilesystemStats{}, false
+	}
+
+	// Filesystems without blocks (e.g. autofs trigger points) are not interesting
+	if stat.Blocks == 0 {
+		return FilesystemStats{}, false
+	}
+
+	bsize := int64(stat.Bsize)
+	s := FilesystemStats{
+		Mountpoint:     mountpoint,
+		SizeBytes:      int64(stat.Blocks) * bsize,
+		AvailableBytes: int64(stat.Bavail) * bsize,
+		InodesTotal:    int64(stat.Files),
+		InodesFree:     int64(stat.Ffree),
+	}
+	s.UsedBytes = s.SizeBytes - int64(stat.Bfree)*bsize
+
+	// Same calculation as `df`: used / (used + available)
+	if s.UsedBytes+s.AvailableBytes > 0 {
+		s.Percent = 100.0 * float64(s.UsedBytes) / float64(s.UsedBytes+s.AvailableBytes)
+	}
+
+	// Some filesystems (btrfs, vfat) report no inode limits
+	if s.InodesTotal > 0 {
+		s.InodesUsed = s.InodesTotal - s.InodesFree
+		s.InodesPercent = 100.0 * float64(s.InodesUsed) / float64(s.InodesTotal)
+	}
+
+	return s, true
+}
+
+// readMountInfo parses a mountinfo file.
+//
+// Format: "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw"
+// The optional fields before the "-" separator vary in number.
+func readMountInfo(filename string) []mountInfo {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var mounts []mountInfo
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 {
+			continue
+		}
+
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep == -1 || sep+2 >= len(fields) {
+			continue
+		}
+
+		mounts = append(mounts, mountInfo{
+			device:     fields[2],
+			mountpoint: unescapeMountPath(fields[4]),
+			fsType:     fields[sep+1],
+			source:     unescapeMountPath(fields[sep+2]),
+		})
+	}
+
+	return mounts
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space etc.) the
+// kernel uses in mount paths.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
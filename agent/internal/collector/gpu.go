@@ -0,0 +1,275 @@
+package collector
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PCI vendor ids of the DRM devices
+const (
+	pciVendorAMD   = "0x1002"
+	pciVendorIntel = "0x8086"
+)
+
+// drmCard matches the card directories, not the connectors ("card0-HDMI-A-1").
+var drmCard = regexp.MustCompile(`^card\d+$`)
+
+// nvidiaQuery are the nvidia-smi --query-gpu fields parsed by parseNvidiaSmi.
+const nvidiaQuery = "name,pci.bus_id,utilization.gpu,memory.used,memory.total,temperature.gpu,power.draw"
+
+// nvidia-smi takes a while even when the driver is fine and hangs when it
+// is not, so it is run at most every nvidiaSmiInterval with a short
+// timeout. After a failure it is retried with an exponential backoff.
+const (
+	nvidiaSmiTimeout    = 5 * time.Second
+	nvidiaSmiInterval   = 30 * time.Second
+	nvidiaSmiMaxBackoff = 30 * time.Minute
+)
+
+// GPUStats holds the utilisation of one GPU. Fields the driver does not
+// provide are nil, e.g. the utilisation of Intel GPUs.
+type GPUStats struct {
+	Vendor        string   `json:"vendor"` // amd, intel or nvidia
+	Name          string   `json:"name,omitempty"`
+	Card          string   `json:"card,omitempty"` // DRM card, e.g. card0
+	PCISlot       string   `json:"pci_slot,omitempty"`
+	UtilPercent   *float64 `json:"util_percent,omitempty"`
+	MemUsedBytes  int64    `json:"mem_used_bytes,omitempty"`
+	MemTotalBytes int64    `json:"mem_total_bytes,omitempty"`
+	MemPercent    float64  `json:"mem_percent,omitempty"`
+	TemperatureC  *float64 `json:"temperature_c,omitempty"`
+	PowerWatts    *float64 `json:"power_watts,omitempty"`
+}
+
+// setMemory sets the VRAM usage and percentage.
+func (g *GPUStats) setMemory(used, total int64) {
+	g.MemUsedBytes = used
+	g.MemTotalBytes = total
+	if total > 0 {
+		g.MemPercent = 100.0 * float64(used) / float64(total)
+	}
+}
+
+// gpuEnergy is a previous energy counter reading for drivers that only
+// report energy, not power (Intel discrete GPUs).
+type gpuEnergy struct {
+	microjoules int64
+	time        time.Time
+}
+
+// GPUCollector reads AMD and Intel GPUs from DRM sysfs and NVIDIA GPUs from
+// nvidia-smi.
+type GPUCollector struct {
+	mu            sync.Mutex
+	drmPath       string
+	run           CommandRunner
+	noNvidiaSmi   bool
+	nvidia        []GPUStats // result of the last nvidia-smi run
+	nvidiaNext    time.Time  // earliest time of the next nvidia-smi run
+	nvidiaBackoff time.Duration
+	prevEnergy    map[string]gpuEnergy
+}
+
+// NewGPUCollector creates a new GPU collector.
+func NewGPUCollector() *GPUCollector {
+	return &GPUCollector{
+		drmPath:    "/sys/class/drm",
+		run:        commandRunner(nvidiaSmiTimeout),
+		prevEnergy: make(map[string]gpuEnergy),
+	}
+}
+
+// Collect returns the stats of all GPUs, or nil if there are none.
+func (g *GPUCollector) Collect() []GPUStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	gpus := g.readDRM()
+	if !g.noNvidiaSmi {
+		gpus = append(gpus, g.readNvidiaSmi()...)
+	}
+
+	return gpus
+}
+
+// readNvidiaSmi returns the NVIDIA GPUs, running nvidia-smi only if the
+// cached result is older than nvidiaSmiInterval or the backoff after a
+// failure has passed.
+func (g *GPUCollector) readNvidiaSmi() []GPUStats {
+	now := time.Now()
+	if now.Before(g.nvidiaNext) {
+		return g.nvidia
+	}
+
+	out, err := g.run("nvidia-smi", "--query-gpu="+nvidiaQuery, "--format=csv,noheader,nounits")
+	if errors.Is(err, exec.ErrNotFound) {
+		// No NVIDIA driver, don't try again
+		g.noNvidiaSmi = true
+		return nil
+	}
+	if err != nil {
+		// Driver not loaded, GPU lost or timeout
+		g.nvidiaBackoff *= 2
+		if g.nvidiaBackoff < nvidiaSmiInterval {
+			g.nvidiaBackoff = nvidiaSmiInterval
+		}
+		if g.nvidiaBackoff > nvidiaSmiMaxBackoff {
+			g.nvidiaBackoff = nvidiaSmiMaxBackoff
+		}
+		g.nvidia = nil
+		g.nvidiaNext = now.Add(g.nvidiaBackoff)
+		return nil
+	}
+
+	g.nvidia = parseNvidiaSmi(string(out))
+	g.nvidiaBackoff = 0
+	g.nvidiaNext = now.Add(nvidiaSmiInterval)
+	return g.nvidia
+}
+
+// readDRM reads the AMD and Intel cards. NVIDIA cards are skipped, the
+// proprietary driver exposes nothing useful in sysfs.
+func (g *GPUCollector) readDRM() []GPUStats {
+	cards, _ := filepath.Glob(filepath.Join(g.drmPath, "card*"))
+	sort.Slice(cards, func(i, j int) bool { return drmIndex(cards[i]) < drmIndex(cards[j]) })
+
+	var gpus []GPUStats
+	for _, card := range cards {
+		name := filepath.Base(card)
+		if !drmCard.MatchString(name) {
+			continue
+		}
+		device := filepath.Join(card, "device")
+
+		gpu := GPUStats{
+			Card: name,
+			Name: readString(filepath.Join(device, "product_name")), // amdgpu, from the VBIOS
+		}
+		switch readString(filepath.Join(device, "vendor")) {
+		case pciVendorAMD:
+			gpu.Vendor = "amd"
+		case pciVendorIntel:
+			gpu.Vendor = "intel"
+		default:
+			continue
+		}
+
+		// device -> ../../../0000:03:00.0
+		if target, err := filepath.EvalSymlinks(device); err == nil {
+			gpu.PCISlot = filepath.Base(target)
+		}
+
+		// amdgpu only; i915 has no utilisation counter in sysfs
+		if busy, ok := readInt(filepath.Join(device, "gpu_busy_percent")); ok {
+			util := float64(busy)
+			gpu.UtilPercent = &util
+		}
+
+		// amdgpu only; Intel integrated GPUs share the system memory
+		if total, ok := readInt(filepath.Join(device, "mem_info_vram_total")); ok && total > 0 {
+			used, _ := readInt(filepath.Join(device, "mem_info_vram_used"))
+			gpu.setMemory(used, total)
+		}
+
+		hwmons, _ := filepath.Glob(filepath.Join(device, "hwmon", "hwmon*"))
+		if len(hwmons) > 0 {
+			g.readGPUHwmon(&gpu, hwmons[0])
+		}
+
+		gpus = append(gpus, gpu)
+	}
+
+	return gpus
+}
+
+// readGPUHwmon reads temperature and power of a card from its hwmon chip.
+func (g *GPUCollector) readGPUHwmon(gpu *GPUStats, dir string) {
+	// amdgpu has edge, junction and mem sensors; edge is temp1
+	if milli, ok := readInt(filepath.Join(dir, "temp1_input")); ok {
+		temp := float64(milli) / 1000
+		gpu.TemperatureC = &temp
+	}
+
+	// amdgpu reports power1_average (older) or power1_input (newer kernels)
+	for _, file := range []string{"power1_average", "power1_input"} {
+		if micro, ok := readInt(filepath.Join(dir, file)); ok {
+			watts := float64(micro) / 1e6
+			gpu.PowerWatts = &watts
+			return
+		}
+	}
+
+	// i915 on discrete GPUs only has a cumulative energy counter
+	micro, ok := readInt(filepath.Join(dir, "energy1_input"))
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if prev, ok := g.prevEnergy[gpu.Card]; ok && micro >= prev.microjoules {
+		if elapsed := now.Sub(prev.time).Seconds(); elapsed > 0 {
+			watts := float64(micro-prev.microjoules) / 1e6 / elapsed
+			gpu.PowerWatts = &watts
+		}
+	}
+	g.prevEnergy[gpu.Card] = gpuEnergy{microjoules: micro, time: now}
+}
+
+// parseNvidiaSmi parses the CSV output of nvidia-smi for nvidiaQuery:
+//
+//	NVIDIA GeForce RTX 3060, 00000000:01:00.0, 12, 1024, 12288, 45, 17.50
+//
+// Unsupported values are reported as "[N/A]" or "[Not Supported]".
+func parseNvidiaSmi(out string) []GPUStats {
+	var gpus []GPUStats
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 7 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		gpu := GPUStats{
+			Vendor:       "nvidia",
+			Name:         fields[0],
+			PCISlot:      strings.ToLower(strings.TrimPrefix(fields[1], "0000")),
+			UtilPercent:  parseNvidiaValue(fields[2]),
+			TemperatureC: parseNvidiaValue(fields[5]),
+			PowerWatts:   parseNvidiaValue(fields[6]),
+		}
+
+		// Memory in MiB
+		used, total := parseNvidiaValue(fields[3]), parseNvidiaValue(fields[4])
+		if used != nil && total != nil {
+			gpu.setMemory(int64(*used)*1024*1024, int64(*total)*1024*1024)
+		}
+
+		gpus = append(gpus, gpu)
+	}
+
+	return gpus
+}
+
+// parseNvidiaValue parses a numeric nvidia-smi field, or returns nil for
+// "[N/A]" and other unsupported values.
+func parseNvidiaValue(s string) *float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// drmIndex returns the number of a "cardN" directory for sorting.
+func drmIndex(dir string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "card"))
+	return n
+}
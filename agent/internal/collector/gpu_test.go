@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeDRM creates a DRM tree with an amdgpu card0 and an i915 card1 and
+// returns the drm directory. The cards link to their PCI devices like in
+// sysfs.
+func fakeDRM(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	amd := "devices/pci0000:00/0000:03:00.0"
+	writeFixture(t, root, amd+"/vendor", "0x1002\n")
+	writeFixture(t, root, amd+"/product_name", "Radeon RX 6600\n")
+	writeFixture(t, root, amd+"/gpu_busy_percent", "37\n")
+	writeFixture(t, root, amd+"/mem_info_vram_total", "8589934592\n")
+	writeFixture(t, root, amd+"/mem_info_vram_used", "2147483648\n")
+	writeFixture(t, root, amd+"/hwmon/hwmon3/temp1_input", "52000\n")
+	writeFixture(t, root, amd+"/hwmon/hwmon3/power1_average", "31000000\n")
+
+	intel := "devices/pci0000:00/0000:00:02.0"
+	writeFixture(t, root, intel+"/vendor", "0x8086\n")
+	writeFixture(t, root, intel+"/hwmon/hwmon5/energy1_input", "1000000\n")
+
+	for card, device := range map[string]string{"card0": amd, "card1": intel} {
+		dir := filepath.Join(root, "class/drm", card)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(root, device), filepath.Join(dir, "device")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Connectors are not cards
+	writeFixture(t, root, "class/drm/card0-HDMI-A-1/status", "connected\n")
+
+	return filepath.Join(root, "class/drm")
+}
+
+func noNvidiaSmi(name string, args ...string) ([]byte, error) {
+	return nil, exec.ErrNotFound
+}
+
+func TestGPUCollectDRM(t *testing.T) {
+	drm := fakeDRM(t)
+	g := &GPUCollector{
+		drmPath:    drm,
+		run:        noNvidiaSmi,
+		prevEnergy: make(map[string]gpuEnergy),
+	}
+
+	gpus := g.Collect()
+	if len(gpus) != 2 {
+		t.Fatalf("got %d GPUs, want 2: %+v", len(gpus), gpus)
+	}
+
+	amd := gpus[0]
+	if amd.Vendor != "amd" || amd.Card != "card0" || amd.Name != "Radeon RX 6600" || amd.PCISlot != "0000:03:00.0" {
+		t.Errorf("amd = %+v", amd)
+	}
+	if amd.UtilPercent == nil || *amd.UtilPercent != 37 {
+		t.Errorf("amd UtilPercent = %v, want 37", amd.UtilPercent)
+	}
+	if amd.MemUsedBytes != 2<<30 || amd.MemTotalBytes != 8<<30 || amd.MemPercent != 25 {
+		t.Errorf("amd memory = %d/%d (%v%%)", amd.MemUsedBytes, amd.MemTotalBytes, amd.MemPercent)
+	}
+	if amd.TemperatureC == nil || *amd.TemperatureC != 52 {
+		t.Errorf("amd TemperatureC = %v, want 52", amd.TemperatureC)
+	}
+	if amd.PowerWatts == nil || *amd.PowerWatts != 31 {
+		t.Errorf("amd PowerWatts = %v, want 31", amd.PowerWatts)
+	}
+
+	intel := gpus[1]
+	if intel.Vendor != "intel" || intel.Card != "card1" || intel.PCISlot != "0000:00:02.0" {
+		t.Errorf("intel = %+v", intel)
+	}
+	if intel.UtilPercent != nil || intel.MemTotalBytes != 0 || intel.TemperatureC != nil {
+		t.Errorf("intel reports values i915 does not have: %+v", intel)
+	}
+	// The first energy reading is the baseline
+	if intel.PowerWatts != nil {
+		t.Errorf("intel PowerWatts = %v on first collection, want nil", *intel.PowerWatts)
+	}
+
+	// 50 J over 10 s is 5 W
+	g.prevEnergy["card1"] = gpuEnergy{microjoules: 1000000, time: time.Now().Add(-10 * time.Second)}
+	writeFixture(t, filepath.Dir(filepath.Dir(drm)), "devices/pci0000:00/0000:00:02.0/hwmon/hwmon5/energy1_input", "51000000\n")
+
+	gpus = g.Collect()
+	if len(gpus) != 2 {
+		t.Fatalf("got %d GPUs, want 2", len(gpus))
+	}
+	if p := gpus[1].PowerWatts; p == nil || math.Abs(*p-5) > 0.1 {
+		t.Errorf("intel PowerWatts = %v, want 5", p)
+	}
+}
+
+func TestGPUCollectNvidiaSmi(t *testing.T) {
+	calls := 0
+	g := &GPUCollector{
+		drmPath: t.TempDir(),
+		run: func(name string, args ...string) ([]byte, error) {
+			calls++
+			return []byte("NVIDIA GeForce RTX 3060, 00000000:01:00.0, 12, 1024, 12288, 45, 17.50\n" +
+				"Tesla K80, 00000000:0A:00.0, [N/A], 0, 11441, 38, [Not Supported]\n"), nil
+		},
+		prevEnergy: make(map[string]gpuEnergy),
+	}
+
+	gpus := g.Collect()
+	if len(gpus) != 2 {
+		t.Fatalf("got %d GPUs, want 2: %+v", len(gpus), gpus)
+	}
+
+	rtx := gpus[0]
+	if rtx.Vendor != "nvidia" || rtx.Name != "NVIDIA GeForce RTX 3060" || rtx.PCISlot != "0000:01:00.0" {
+		t.Errorf("rtx = %+v", rtx)
+	}
+	if rtx.UtilPercent == nil || *rtx.UtilPercent != 12 || rtx.TemperatureC == nil || *rtx.TemperatureC != 45 {
+		t.Errorf("rtx utilisation/temperature = %v/%v", rtx.UtilPercent, rtx.TemperatureC)
+	}
+	if rtx.PowerWatts == nil || *rtx.PowerWatts != 17.5 {
+		t.Errorf("rtx PowerWatts = %v, want 17.5", rtx.PowerWatts)
+	}
+	if rtx.MemUsedBytes != 1024<<20 || rtx.MemTotalBytes != 12288<<20 {
+		t.Errorf("rtx memory = %d/%d", rtx.MemUsedBytes, rtx.MemTotalBytes)
+	}
+
+	tesla := gpus[1]
+	if tesla.PCISlot != "0000:0a:00.0" {
+		t.Errorf("tesla PCISlot = %q", tesla.PCISlot)
+	}
+	if tesla.UtilPercent != nil || tesla.PowerWatts != nil {
+		t.Errorf("tesla unsupported values = %v/%v, want nil", tesla.UtilPercent, tesla.PowerWatts)
+	}
+	if tesla.TemperatureC == nil || *tesla.TemperatureC != 38 || tesla.MemTotalBytes != 11441<<20 {
+		t.Errorf("tesla = %+v", tesla)
+	}
+
+	// The result is cached between pushes
+	if gpus := g.Collect(); len(gpus) != 2 || calls != 1 {
+		t.Errorf("second collection returned %d GPUs with %d nvidia-smi runs, want 2 with 1", len(gpus), calls)
+	}
+}
+
+func TestGPUCollectNvidiaSmiBackoff(t *testing.T) {
+	calls := 0
+	var err error
+	g := &GPUCollector{
+		drmPath: t.TempDir(),
+		run: func(name string, args ...string) ([]byte, error) {
+			calls++
+			return nil, err
+		},
+		prevEnergy: make(map[string]gpuEnergy),
+	}
+
+	err = errors.New("exit status 9")
+	for _, want := range []time.Duration{nvidiaSmiInterval, 2 * nvidiaSmiInterval, 4 * nvidiaSmiInterval} {
+		g.nvidiaNext = time.Time{}
+		if gpus := g.Collect(); gpus != nil {
+			t.Errorf("Collect = %+v, want nil", gpus)
+		}
+		if g.nvidiaBackoff != want {
+			t.Errorf("backoff = %v, want %v", g.nvidiaBackoff, want)
+		}
+	}
+
+	// No retry before the backoff has passed
+	g.Collect()
+	if calls != 3 {
+		t.Errorf("nvidia-smi ran %d times, want 3", calls)
+	}
+
+	g.nvidiaBackoff = nvidiaSmiMaxBackoff
+	g.nvidiaNext = time.Time{}
+	g.Collect()
+	if g.nvidiaBackoff != nvidiaSmiMaxBackoff {
+		t.Errorf("backoff = %v, want at most %v", g.nvidiaBackoff, nvidiaSmiMaxBackoff)
+	}
+
+	// A missing nvidia-smi is not retried
+	err = exec.ErrNotFound
+	g.nvidiaNext = time.Time{}
+	g.Collect()
+	g.nvidiaNext = time.Time{}
+	g.Collect()
+	if !g.noNvidiaSmi || calls != 5 {
+		t.Errorf("noNvidiaSmi = %v after %d runs, want true after 5", g.noNvidiaSmi, calls)
+	}
+}
@@ -0,0 +1,572 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// inventoryInterval is how often the inventory is gathered again to detect
+// changes, e.g. hotplugged disks or USB devices.
+const inventoryInterval = 5 * time.Minute
+
+// inventoryDisk matches whole disks in /sys/block, not partitions or
+// virtual block devices.
+var inventoryDisk = regexp.MustCompile(`^(sd[a-z]+|hd[a-z]+|vd[a-z]+|xvd[a-z]+|nvme\d+n\d+|mmcblk\d+)$`)
+
+// inventoryCPUFlags are the CPU flags worth showing.
+var inventoryCPUFlags = []string{"aes", "avx", "avx2", "avx512f", "sse4_1", "sse4_2", "vmx", "svm", "hypervisor"}
+
+// pciClasses maps the PCI base class to its name and device type.
+var pciClasses = map[string][2]string{
+	"01": {"Mass storage controller", "storage"},
+	"02": {"Network controller", "network"},
+	"03": {"Display controller", "gpu"},
+	"04": {"Multimedia controller", "audio"},
+	"06": {"Bridge", "bridge"},
+	"07": {"Communication controller", "serial"},
+	"08": {"System peripheral", "system"},
+	"0c": {"Serial bus controller", "usb"},
+}
+
+// InventorySystem holds the DMI system identification. On boards without
+// DMI the device-tree model is used as product.
+type InventorySystem struct {
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	BoardVendor  string `json:"board_vendor,omitempty"`
+	BoardName    string `json:"board_name,omitempty"`
+	BIOSVersion  string `json:"bios_version,omitempty"`
+	BIOSDate     string `json:"bios_date,omitempty"`
+	BootMode     string `json:"boot_mode"` // UEFI or Legacy
+	Model        string `json:"model,omitempty"`
+}
+
+// InventoryCPU describes the processor from /proc/cpuinfo and cpufreq.
+type InventoryCPU struct {
+	Model       string  `json:"model"`
+	Vendor      string  `json:"vendor,omitempty"`
+	Cores       int     `json:"cores"`
+	Threads     int     `json:"threads"`
+	Arch        string  `json:"arch"`
+	MinMHz      float64 `json:"min_mhz,omitempty"`
+	MaxMHz      float64 `json:"max_mhz,omitempty"`
+	Stepping    string  `json:"stepping,omitempty"`
+	Microcode   string  `json:"microcode,omitempty"`
+	VirtSupport string  `json:"virt_support"` // vmx, svm or none
+	Flags       string  `json:"flags,omitempty"`
+	Bugs        string  `json:"bugs,omitempty"`
+}
+
+// InventoryMemory holds the installed memory and swap.
+type InventoryMemory struct {
+	TotalBytes     int64 `json:"total_bytes"`
+	SwapTotalBytes int64 `json:"swap_total_bytes"`
+}
+
+// InventoryOS holds the distribution from /etc/os-release.
+type InventoryOS struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	PrettyName string `json:"pretty_name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	VersionID  string `json:"version_id,omitempty"`
+	Codename   string `json:"codename,omitempty"`
+}
+
+// InventoryKernel holds the uname fields.
+type InventoryKernel struct {
+	Name     string `json:"name"`
+	Release  string `json:"release"`
+	Version  string `json:"version"`
+	Machine  string `json:"machine"`
+	Hostname string `json:"hostname"`
+}
+
+// InventoryDisk is a whole disk from /sys/block.
+type InventoryDisk struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+	Model     string `json:"model,omitempty"`
+	Vendor    string `json:"vendor,omitempty"`
+	Serial    string `json:"serial,omitempty"`
+	Type      string `json:"type"` // HDD, SSD or NVMe
+	IsSSD     bool   `json:"is_ssd"`
+	Transport string `json:"transport,omitempty"`
+	Scheduler string `json:"scheduler,omitempty"`
+	Removable bool   `json:"removable"`
+}
+
+// PCIDevice is a device from /sys/bus/pci/devices.
+type PCIDevice struct {
+	Slot     string `json:"slot"`
+	Class    string `json:"class"`
+	ClassID  string `json:"class_id"`
+	VendorID string `json:"vendor_id"`
+	DeviceID string `json:"device_id"`
+	Driver   string `json:"driver,omitempty"`
+	Type     string `json:"type"`
+}
+
+// USBDevice is a device from /sys/bus/usb/devices. Root hubs are omitted.
+type USBDevice struct {
+	Bus          int    `json:"bus"`
+	Device       int    `json:"device"`
+	VendorID     string `json:"vendor_id"`
+	ProductID    string `json:"product_id"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	SpeedMbps    string `json:"speed_mbps,omitempty"`
+}
+
+// Inventory is the static hardware and OS description of the host. The
+// layout follows the hardware script so the server stores both alike.
+type Inventory struct {
+	System     InventorySystem `json:"system"`
+	CPU        InventoryCPU    `json:"cpu"`
+	Memory     InventoryMemory `json:"memory"`
+	OS         InventoryOS     `json:"os"`
+	Kernel     InventoryKernel `json:"kernel"`
+	Disks      []InventoryDisk `json:"disks"`
+	PCIDevices []PCIDevice     `json:"pci_devices"`
+	USBDevices []USBDevice     `json:"usb_devices"`
+
+	Virtualization *Virtualization `json:"virtualization"`
+}
+
+// InventoryCollector gathers the static host inventory.
+type InventoryCollector struct {
+	mu           sync.Mutex
+	rootPath     string
+	procPath     string
+	sysPath      string
+	etcPath      string
+	dockerSocket string
+	isProxmox    func() bool
+	uname        func(*syscall.Utsname) error
+	last         time.Time
+	lastKey      string     // last inventory the server received
+	unsent       *Inventory // changed inventory not passed to Sent yet
+}
+
+// NewInventoryCollector creates a new inventory collector. isProxmox
+// reports whether the host is a Proxmox VE node.
+func NewInventoryCollector(isProxmox func() bool, dockerSocket string) *InventoryCollector {
+	return &InventoryCollector{
+		rootPath:     "/",
+		procPath:     "/proc",
+		sysPath:      "/sys",
+		etcPath:      "/etc",
+		dockerSocket: dockerSocket,
+		isProxmox:    isProxmox,
+		uname:        syscall.Uname,
+	}
+}
+
+// Collect returns the inventory. Unless force is set, the inventory is
+// gathered at most every inventoryInterval and only returned if it changed
+// since it was last passed to Sent; otherwise Collect returns nil. A
+// changed inventory is returned until it is sent.
+func (i *InventoryCollector) Collect(force bool) *Inventory {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !force && time.Since(i.last) < inventoryInterval {
+		return i.unsent
+	}
+	i.last = time.Now()
+
+	inv := &Inventory{
+		System:     i.readSystem(),
+		CPU:        i.readCPU(),
+		OS:         i.readOSRelease(),
+		Kernel:     i.readKernel(),
+		Disks:      i.readDisks(),
+		PCIDevices: i.readPCI(),
+		USBDevices: i.readUSB(),
+	}
+	inv.CPU.Arch = inv.Kernel.Machine
+	inv.Virtualization = i.readVirtualization(inv.System, inv.CPU)
+
+	meminfo := readMeminfo(filepath.Join(i.procPath, "meminfo"))
+	inv.Memory = InventoryMemory{
+		TotalBytes:     meminfo["MemTotal"],
+		SwapTotalBytes: meminfo["SwapTotal"],
+	}
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return nil
+	}
+	if !force && string(data) == i.lastKey {
+		i.unsent = nil
+		return nil
+	}
+	i.unsent = inv
+
+	return inv
+}
+
+// Sent records that the server received an inventory returned by Collect.
+func (i *InventoryCollector) Sent(inv *Inventory) {
+	if inv == nil {
+		return
+	}
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.lastKey = string(data)
+	if i.unsent == inv {
+		i.unsent = nil
+	}
+}
+
+// readSystem reads the DMI identification and the device-tree model.
+func (i *InventoryCollector) readSystem() InventorySystem {
+	dmi := filepath.Join(i.sysPath, "class", "dmi", "id")
+	sys := InventorySystem{
+		Manufacturer: readString(filepath.Join(dmi, "sys_vendor")),
+		Product:      readString(filepath.Join(dmi, "product_name")),
+		Serial:       readString(filepath.Join(dmi, "product_serial")), // root only
+		BoardVendor:  readString(filepath.Join(dmi, "board_vendor")),
+		BoardName:    readString(filepath.Join(dmi, "board_name")),
+		BIOSVersion:  readString(filepath.Join(dmi, "bios_version")),
+		BIOSDate:     readString(filepath.Join(dmi, "bios_date")),
+		BootMode:     "Legacy",
+		// The device-tree strings are NUL terminated
+		Model: strings.TrimRight(readString(filepath.Join(i.procPath, "device-tree", "model")), "\x00"),
+	}
+
+	if fileExists(filepath.Join(i.sysPath, "firmware", "efi")) {
+		sys.BootMode = "UEFI"
+	}
+	if sys.Product == "" {
+		sys.Product = sys.Model
+	}
+
+	return sys
+}
+
+// readCPU parses the first processor block of /proc/cpuinfo and counts
+// cores and threads over all blocks.
+func (i *InventoryCollector) readCPU() InventoryCPU {
+	cpu := InventoryCPU{VirtSupport: "none"}
+
+	file, err := os.Open(filepath.Join(i.procPath, "cpuinfo"))
+	if err != nil {
+		return cpu
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	cores := make(map[string]bool)
+	var physicalID string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch key {
+		case "processor":
+			cpu.Threads++
+		case "physical id":
+			physicalID = value
+		case "core id":
+			cores[physicalID+"/"+value] = true
+		}
+		if _, seen := values[key]; !seen {
+			values[key] = value
+		}
+	}
+
+	cpu.Cores = len(cores)
+	if cpu.Cores == 0 {
+		// ARM has no core ids, every processor is a core
+		cpu.Cores = cpu.Threads
+	}
+
+	cpu.Model = values["model name"]
+	if cpu.Model == "" {
+		// Raspberry Pi and other ARM boards
+		cpu.Model = values["Hardware"]
+	}
+	cpu.Vendor = values["vendor_id"]
+	cpu.Stepping = values["stepping"]
+	cpu.Microcode = values["microcode"]
+	cpu.Bugs = values["bugs"]
+
+	flags := values["flags"]
+	if flags == "" {
+		flags = values["Features"]
+	}
+	present := make(map[string]bool)
+	for _, f := range strings.Fields(flags) {
+		present[f] = true
+	}
+	var important []string
+	for _, f := range inventoryCPUFlags {
+		if present[f] {
+			important = append(important, f)
+		}
+	}
+	cpu.Flags = strings.Join(important, " ")
+
+	if present["vmx"] {
+		cpu.VirtSupport = "vmx"
+	} else if present["svm"] {
+		cpu.VirtSupport = "svm"
+	}
+
+	cpufreq := filepath.Join(i.sysPath, "devices", "system", "cpu", "cpu0", "cpufreq")
+	if khz, ok := readInt(filepath.Join(cpufreq, "cpuinfo_min_freq")); ok {
+		cpu.MinMHz = float64(khz) / 1000
+	}
+	if khz, ok := readInt(filepath.Join(cpufreq, "cpuinfo_max_freq")); ok {
+		cpu.MaxMHz = float64(khz) / 1000
+	}
+
+	return cpu
+}
+
+// readOSRelease parses /etc/os-release.
+func (i *InventoryCollector) readOSRelease() InventoryOS {
+	data, err := os.ReadFile(filepath.Join(i.etcPath, "os-release"))
+	if err != nil {
+		return InventoryOS{}
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		values[key] = value
+	}
+
+	return InventoryOS{
+		ID:         values["ID"],
+		Name:       values["NAME"],
+		PrettyName: values["PRETTY_NAME"],
+		Version:    values["VERSION"],
+		VersionID:  values["VERSION_ID"],
+		Codename:   values["VERSION_CODENAME"],
+	}
+}
+
+// readKernel returns the uname fields.
+func (i *InventoryCollector) readKernel() InventoryKernel {
+	var uts syscall.Utsname
+	if err := i.uname(&uts); err != nil {
+		return InventoryKernel{}
+	}
+
+	return InventoryKernel{
+		Name:     utsString(uts.Sysname[:]),
+		Release:  utsString(uts.Release[:]),
+		Version:  utsString(uts.Version[:]),
+		Machine:  utsString(uts.Machine[:]),
+		Hostname: utsString(uts.Nodename[:]),
+	}
+}
+
+// utsString converts a NUL terminated Utsname field, which is int8 or
+// uint8 depending on the architecture.
+func utsString[T int8 | uint8](field []T) string {
+	b := make([]byte, 0, len(field))
+	for _, c := range field {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
+
+// readDisks lists the whole disks in /sys/block.
+func (i *InventoryCollector) readDisks() []InventoryDisk {
+	entries, err := os.ReadDir(filepath.Join(i.sysPath, "block"))
+	if err != nil {
+		return nil
+	}
+
+	var disks []InventoryDisk
+	for _, e := range entries {
+		name := e.Name()
+		if !inventoryDisk.MatchString(name) {
+			continue
+		}
+
+		dir := filepath.Join(i.sysPath, "block", name)
+		sectors, _ := readInt(filepath.Join(dir, "size"))
+		if sectors == 0 {
+			// Empty card readers and optical drives
+			continue
+		}
+
+		disk := InventoryDisk{
+			Name:      name,
+			SizeBytes: sectors * 512, // always 512 byte units
+			Model:     readString(filepath.Join(dir, "device", "model")),
+			Vendor:    readString(filepath.Join(dir, "device", "vendor")),
+			Serial:    readString(filepath.Join(dir, "device", "serial")),
+			Type:      "HDD",
+			Transport: diskTransport(dir, name),
+			Scheduler: activeScheduler(readString(filepath.Join(dir, "queue", "scheduler"))),
+		}
+		if disk.Serial == "" {
+			disk.Serial = readString(filepath.Join(dir, "device", "wwid"))
+		}
+		if removable, _ := readInt(filepath.Join(dir, "removable")); removable == 1 {
+			disk.Removable = true
+		}
+		if rotational, ok := readInt(filepath.Join(dir, "queue", "rotational")); ok && rotational == 0 {
+			disk.IsSSD = true
+			disk.Type = "SSD"
+			if disk.Transport == "nvme" {
+				disk.Type = "NVMe"
+			}
+		}
+
+		disks = append(disks, disk)
+	}
+
+	return disks
+}
+
+// diskTransport guesses the bus of a disk from its name and sysfs path.
+func diskTransport(dir, name string) string {
+	switch {
+	case strings.HasPrefix(name, "nvme"):
+		return "nvme"
+	case strings.HasPrefix(name, "mmcblk"):
+		return "mmc"
+	case strings.HasPrefix(name, "vd"):
+		return "virtio"
+	case strings.HasPrefix(name, "xvd"):
+		return "xen"
+	}
+
+	// /sys/block/sda -> ../devices/pci0000:00/0000:00:14.0/usb2/2-1/.../block/sda
+	target, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case strings.Contains(target, "/usb"):
+		return "usb"
+	case strings.Contains(target, "/ata"):
+		return "sata"
+	case strings.Contains(target, "/virtio"):
+		return "virtio"
+	}
+	return ""
+}
+
+// activeScheduler returns the bracketed entry of "mq-deadline [none] bfq".
+func activeScheduler(s string) string {
+	if start := strings.IndexByte(s, '['); start >= 0 {
+		if end := strings.IndexByte(s[start:], ']'); end > 0 {
+			return s[start+1 : start+end]
+		}
+	}
+	return ""
+}
+
+// readPCI lists the PCI devices. Device names need the pci.ids database,
+// so only the numeric ids and the class are reported.
+func (i *InventoryCollector) readPCI() []PCIDevice {
+	dirs, _ := filepath.Glob(filepath.Join(i.sysPath, "bus", "pci", "devices", "*"))
+
+	var devices []PCIDevice
+	for _, dir := range dirs {
+		// class: 0x030000 (base class, subclass, programming interface)
+		class := strings.TrimPrefix(readString(filepath.Join(dir, "class")), "0x")
+		if len(class) != 6 {
+			continue
+		}
+
+		dev := PCIDevice{
+			Slot:     strings.TrimPrefix(filepath.Base(dir), "0000:"),
+			Class:    "Other",
+			ClassID:  class[:4],
+			VendorID: strings.TrimPrefix(readString(filepath.Join(dir, "vendor")), "0x"),
+			DeviceID: strings.TrimPrefix(readString(filepath.Join(dir, "device")), "0x"),
+			Type:     "other",
+		}
+		if c, ok := pciClasses[class[:2]]; ok {
+			dev.Class, dev.Type = c[0], c[1]
+		}
+		if dev.Type == "usb" && class[:4] != "0c03" {
+			// Serial bus controllers other than USB, e.g. SMBus
+			dev.Type = "system"
+		}
+		if link, err := os.Readlink(filepath.Join(dir, "driver")); err == nil {
+			dev.Driver = filepath.Base(link)
+		}
+
+		devices = append(devices, dev)
+	}
+
+	return devices
+}
+
+// readUSB lists the USB devices except the root hubs.
+func (i *InventoryCollector) readUSB() []USBDevice {
+	dirs, _ := filepath.Glob(filepath.Join(i.sysPath, "bus", "usb", "devices", "*"))
+
+	var devices []USBDevice
+	for _, dir := range dirs {
+		// Interfaces ("1-1:1.0") have no idVendor
+		vendor := readString(filepath.Join(dir, "idVendor"))
+		if vendor == "" || strings.HasPrefix(filepath.Base(dir), "usb") {
+			continue
+		}
+
+		bus, _ := readInt(filepath.Join(dir, "busnum"))
+		devnum, _ := readInt(filepath.Join(dir, "devnum"))
+		devices = append(devices, USBDevice{
+			Bus:          int(bus),
+			Device:       int(devnum),
+			VendorID:     vendor,
+			ProductID:    readString(filepath.Join(dir, "idProduct")),
+			Manufacturer: readString(filepath.Join(dir, "manufacturer")),
+			Product:      readString(filepath.Join(dir, "product")),
+			SpeedMbps:    readString(filepath.Join(dir, "speed")),
+		})
+	}
+
+	sort.Slice(devices, func(a, b int) bool {
+		if devices[a].Bus != devices[b].Bus {
+			return devices[a].Bus < devices[b].Bus
+		}
+		return devices[a].Device < devices[b].Device
+	})
+
+	return devices
+}
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inotifyInterval is how often the inotify usage is counted. It requires
+// reading the fdinfo of every inotify descriptor on the system.
+const inotifyInterval = 60 * time.Second
+
+// ResourceUsage is the usage of a kernel limit.
+type ResourceUsage struct {
+	Used    int64   `json:"used"`
+	Limit   int64   `json:"limit"`
+	Percent float64 `json:"percent"`
+}
+
+// newResourceUsage creates a ResourceUsage, or returns nil if the limit is
+// unknown.
+func newResourceUsage(used, limit int64) *ResourceUsage {
+	if limit <= 0 {
+		return nil
+	}
+	return &ResourceUsage{
+		Used:    used,
+		Limit:   limit,
+		Percent: 100.0 * float64(used) / float64(limit),
+	}
+}
+
+// KernelLimits holds the usage of kernel-wide resource limits. The inotify
+// limits apply per user, so the values of the user with the most watches
+// (instances) are reported. Conntrack is nil if nf_conntrack is not loaded.
+type KernelLimits struct {
+	FileHandles      *ResourceUsage `json:"file_handles,omitempty"`
+	Conntrack        *ResourceUsage `json:"conntrack,omitempty"`
+	PIDs             *ResourceUsage `json:"pids,omitempty"`
+	Threads          *ResourceUsage `json:"threads,omitempty"`
+	InotifyWatches   *ResourceUsage `json:"inotify_watches,omitempty"`
+	InotifyInstances *ResourceUsage `json:"inotify_instances,omitempty"`
+}
+
+// LimitsCollector reports usage of kernel resource limits.
+type LimitsCollector struct {
+	mu          sync.Mutex
+	procPath    string
+	lastInotify time.Time
+	watches     *ResourceUsage
+	instances   *ResourceUsage
+}
+
+// NewLimitsCollector creates a new kernel limits collector.
+func NewLimitsCollector() *LimitsCollector {
+	return &LimitsCollector{procPath: "/proc"}
+}
+
+// Collect returns the current usage of the kernel limits.
+func (l *LimitsCollector) Collect() *KernelLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limits := &KernelLimits{}
+	sys := filepath.Join(l.procPath, "sys")
+
+	// file-nr: allocated, free (always 0 since 2.6), max
+	if fields := strings.Fields(readString(filepath.Join(sys, "fs", "file-nr"))); len(fields) == 3 {
+		allocated, _ := strconv.ParseInt(fields[0], 10, 64)
+		free, _ := strconv.ParseInt(fields[1], 10, 64)
+		max, _ := strconv.ParseInt(fields[2], 10, 64)
+		limits.FileHandles = newResourceUsage(allocated-free, max)
+	}
+
+	if count, ok := readInt(filepath.Join(sys, "net", "netfilter", "nf_conntrack_count")); ok {
+		max, _ := readInt(filepath.Join(sys, "net", "netfilter", "nf_conntrack_max"))
+		limits.Conntrack = newResourceUsage(count, max)
+	}
+
+	// Every thread uses a PID. The fourth field of loadavg is
+	// "runnable/total" scheduling entities, i.e. threads.
+	if fields := strings.Fields(readString(filepath.Join(l.procPath, "loadavg"))); len(fields) >= 4 {
+		if _, total, ok := strings.Cut(fields[3], "/"); ok {
+			threads, _ := strconv.ParseInt(total, 10, 64)
+			pidMax, _ := readInt(filepath.Join(sys, "kernel", "pid_max"))
+			threadsMax, _ := readInt(filepath.Join(sys, "kernel", "threads-max"))
+			limits.PIDs = newResourceUsage(threads, pidMax)
+			limits.Threads = newResourceUsage(threads, threadsMax)
+		}
+	}
+
+	if time.Since(l.lastInotify) >= inotifyInterval {
+		l.lastInotify = time.Now()
+		l.watches, l.instances = l.readInotify()
+	}
+	limits.InotifyWatches = l.watches
+	limits.InotifyInstances = l.instances
+
+	return limits
+}
+
+// readInotify counts inotify instances and watches per user by looking for
+// "anon_inode:inotify" descriptors and their "inotify wd:" fdinfo lines.
+func (l *LimitsCollector) readInotify() (watches, instances *ResourceUsage) {
+	maxWatches, _ := readInt(filepath.Join(l.procPath, "sys", "fs", "inotify", "max_user_watches"))
+	maxInstances, _ := readInt(filepath.Join(l.procPath, "sys", "fs", "inotify", "max_user_instances"))
+
+	watchesByUID := make(map[string]int64)
+	instancesByUID := make(map[string]int64)
+
+	entries, _ := os.ReadDir(l.procPath)
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+
+		dir := filepath.Join(l.procPath, e.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+
+		var uid string
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || link != "anon_inode:inotify" {
+				continue
+			}
+
+			if uid == "" {
+				uid = readStatusField(filepath.Join(dir, "status"), "Uid:")
+			}
+			instancesByUID[uid]++
+
+			data, err := os.ReadFile(filepath.Join(dir, "fdinfo", fd.Name()))
+			if err != nil {
+				continue
+			}
+			watchesByUID[uid] += int64(strings.Count(string(data), "inotify wd:"))
+		}
+	}
+
+	return newResourceUsage(maxValue(watchesByUID), maxWatches),
+		newResourceUsage(maxValue(instancesByUID), maxInstances)
+}
+
+// maxValue returns the largest value of the map, or 0 if it is empty.
+func maxValue(m map[string]int64) int64 {
+	var max int64
+	for _, v := range m {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
@@ -0,0 +1,291 @@
+package collector
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// lvmInterval is how often lvs and vgs are run. Both scan devices and take
+// the LVM lock, so they are not run on every push.
+const lvmInterval = 60 * time.Second
+
+// EventThinPoolUsage is raised when the data or metadata usage of a thin
+// pool crosses the warning or critical threshold.
+const EventThinPoolUsage = "thin_pool_usage"
+
+// VGStats holds the capacity of a volume group.
+type VGStats struct {
+	Name        string  `json:"name"`
+	SizeBytes   int64   `json:"size_bytes"`
+	FreeBytes   int64   `json:"free_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+	PVCount     int     `json:"pv_count"`
+	LVCount     int     `json:"lv_count"`
+}
+
+// LVStats describes a logical volume. DataPercent is only set for thin
+// volumes and snapshots.
+type LVStats struct {
+	VG          string  `json:"vg"`
+	Name        string  `json:"name"`
+	Attr        string  `json:"attr"`
+	SizeBytes   int64   `json:"size_bytes"`
+	Pool        string  `json:"pool,omitempty"`
+	DataPercent float64 `json:"data_percent,omitempty"`
+}
+
+// ThinPoolStats holds the usage of a thin pool. A full metadata volume
+// switches the pool to read-only or corrupts it, so it is reported
+// separately from the data usage.
+type ThinPoolStats struct {
+	VG                string  `json:"vg"`
+	Name              string  `json:"name"`
+	SizeBytes         int64   `json:"size_bytes"`
+	DataPercent       float64 `json:"data_percent"`
+	MetadataSizeBytes int64   `json:"metadata_size_bytes"`
+	MetadataPercent   float64 `json:"metadata_percent"`
+}
+
+// LVMStats holds volume groups, logical volumes and thin pools.
+type LVMStats struct {
+	VGs       []VGStats       `json:"vgs"`
+	LVs       []LVStats       `json:"lvs"`
+	ThinPools []ThinPoolStats `json:"thin_pools"`
+}
+
+// lvmReport is the `--reportformat json` output of lvs and vgs. All values
+// are strings.
+type lvmReport struct {
+	Report []struct {
+		VG []map[string]string `json:"vg"`
+		LV []map[string]string `json:"lv"`
+	} `json:"report"`
+}
+
+// Thin pool usage levels, ordered by severity.
+const (
+	thinLevelOK = iota
+	thinLevelWarning
+	thinLevelCritical
+)
+
+// LVMCollector reports LVM usage via lvs and vgs. They hang on missing or
+// suspended PVs, so they run in the background and Collect returns the
+// result of the last completed run.
+type LVMCollector struct {
+	mu         sync.Mutex
+	run        CommandRunner
+	warn       float64
+	crit       float64
+	last       time.Time
+	refreshing bool
+	cached     *LVMStats
+	events     []Event
+	interval   time.Duration
+
+	// Last reported usage level per "vg/pool/data" and "vg/pool/metadata",
+	// only used by refresh
+	levels map[string]int
+}
+
+// NewLVMCollector creates an LVM collector.
+func NewLVMCollector(cfg config.LVMConfig) *LVMCollector {
+	return &LVMCollector{
+		run:      runCommand,
+		warn:     cfg.ThinWarnPercent,
+		crit:     cfg.ThinCritPercent,
+		interval: lvmInterval,
+		levels:   make(map[string]int),
+	}
+}
+
+// Collect returns the LVM usage and a thin_pool_usage event for each
+// threshold crossed since the last refresh. A refresh is started in the
+// background at most every lvmInterval, so the first call returns nil. It
+// also returns nil on hosts without LVM or without volume groups.
+func (l *LVMCollector) Collect() (*LVMStats, []Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.refreshing && time.Since(l.last) >= l.interval {
+		l.last = time.Now()
+		l.refreshing = true
+		go l.refresh()
+	}
+
+	events := l.events
+	l.events = nil
+	return l.cached, events
+}
+
+// refresh runs vgs and lvs and stores the result and the events for the
+// next Collect.
+func (l *LVMCollector) refresh() {
+	stats, events := l.read()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cached = stats
+	l.events = append(l.events, events...)
+	l.refreshing = false
+}
+
+// read returns the LVM usage and the threshold events, or nil if there are
+// no volume groups.
+func (l *LVMCollector) read() (*LVMStats, []Event) {
+	vgs := l.listVGs()
+	if len(vgs) == 0 {
+		return nil, nil
+	}
+
+	stats := &LVMStats{VGs: vgs}
+	stats.LVs, stats.ThinPools = l.listLVs()
+
+	var events []Event
+	for _, pool := range stats.ThinPools {
+		if e, ok := l.checkThreshold(pool, "data", pool.DataPercent); ok {
+			events = append(events, e)
+		}
+		if e, ok := l.checkThreshold(pool, "metadata", pool.MetadataPercent); ok {
+			events = append(events, e)
+		}
+	}
+
+	return stats, events
+}
+
+// checkThreshold returns an event if usage moved up to a more severe level
+// since the last check. Falling back below a threshold re-arms it.
+func (l *LVMCollector) checkThreshold(pool ThinPoolStats, metric string, percent float64) (Event, bool) {
+	level := thinLevelOK
+	switch {
+	case percent >= l.crit:
+		level = thinLevelCritical
+	case percent >= l.warn:
+		level = thinLevelWarning
+	}
+
+	key := pool.VG + "/" + pool.Name + "/" + metric
+	prev := l.levels[key]
+	l.levels[key] = level
+
+	if level <= prev {
+		return Event{}, false
+	}
+
+	severity, threshold := "warning", l.warn
+	if level == thinLevelCritical {
+		severity, threshold = "critical", l.crit
+	}
+
+	return newEvent(EventThinPoolUsage, map[string]interface{}{
+		"vg":        pool.VG,
+		"pool":      pool.Name,
+		"metric":    metric,
+		"severity":  severity,
+		"percent":   percent,
+		"threshold": threshold,
+	}), true
+}
+
+// listVGs runs vgs.
+func (l *LVMCollector) listVGs() []VGStats {
+	out, err := l.run("vgs", "--reportformat", "json", "--units", "b", "--nosuffix",
+		"-o", "vg_name,vg_size,vg_free,pv_count,lv_count")
+	if err != nil {
+		return nil
+	}
+
+	var report lvmReport
+	if json.Unmarshal(out, &report) != nil {
+		return nil
+	}
+
+	var vgs []VGStats
+	for _, r := range report.Report {
+		for _, row := range r.VG {
+			vg := VGStats{
+				Name:      row["vg_name"],
+				SizeBytes: lvmInt(row["vg_size"]),
+				FreeBytes: lvmInt(row["vg_free"]),
+				PVCount:   int(lvmInt(row["pv_count"])),
+				LVCount:   int(lvmInt(row["lv_count"])),
+			}
+			if vg.SizeBytes > 0 {
+				vg.UsedPercent = 100.0 * float64(vg.SizeBytes-vg.FreeBytes) / float64(vg.SizeBytes)
+			}
+			vgs = append(vgs, vg)
+		}
+	}
+
+	return vgs
+}
+
+// listLVs runs lvs and splits the result into logical volumes and thin
+// pools. Hidden volumes (e.g. [data_tmeta]) are skipped.
+func (l *LVMCollector) listLVs() ([]LVStats, []ThinPoolStats) {
+	out, err := l.run("lvs", "--reportformat", "json", "--units", "b", "--nosuffix",
+		"-o", "vg_name,lv_name,lv_attr,lv_size,pool_lv,data_percent,metadata_percent,lv_metadata_size")
+	if err != nil {
+		return nil, nil
+	}
+
+	var report lvmReport
+	if json.Unmarshal(out, &report) != nil {
+		return nil, nil
+	}
+
+	var lvs []LVStats
+	var pools []ThinPoolStats
+	for _, r := range report.Report {
+		for _, row := range r.LV {
+			name := row["lv_name"]
+			if strings.HasPrefix(name, "[") {
+				continue
+			}
+
+			attr := row["lv_attr"]
+			// First lv_attr character is the volume type, "t" is a thin pool
+			if strings.HasPrefix(attr, "t") {
+				pools = append(pools, ThinPoolStats{
+					VG:                row["vg_name"],
+					Name:              name,
+					SizeBytes:         lvmInt(row["lv_size"]),
+					DataPercent:       lvmFloat(row["data_percent"]),
+					MetadataSizeBytes: lvmInt(row["lv_metadata_size"]),
+					MetadataPercent:   lvmFloat(row["metadata_percent"]),
+				})
+				continue
+			}
+
+			lvs = append(lvs, LVStats{
+				VG:          row["vg_name"],
+				Name:        name,
+				Attr:        attr,
+				SizeBytes:   lvmInt(row["lv_size"]),
+				Pool:        row["pool_lv"],
+				DataPercent: lvmFloat(row["data_percent"]),
+			})
+		}
+	}
+
+	return lvs, pools
+}
+
+// lvmInt parses an integer field. Empty fields are 0.
+func lvmInt(s string) int64 {
+	v, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return v
+}
+
+// lvmFloat parses a percentage field. Empty fields are 0.
+func lvmFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v
+}
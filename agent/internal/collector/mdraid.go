@@ -0,0 +1,254 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EventRAIDDegraded is raised when an array loses a member or starts
+// rebuilding.
+const EventRAIDDegraded = "raid_degraded"
+
+// MDMember describes a member device of an md array.
+type MDMember struct {
+	Device string `json:"device"`
+	Slot   int    `json:"slot"`  // -1 for spares
+	State  string `json:"state"` // e.g. in_sync, faulty, spare, write_mostly
+}
+
+// MDArrayStats holds the status of a Linux software RAID (md) array.
+type MDArrayStats struct {
+	Name          string     `json:"name"`
+	Level         string     `json:"level"`
+	State         string     `json:"state"` // array_state, e.g. clean, active, degraded
+	RaidDisks     int        `json:"raid_disks"`
+	ActiveDisks   int        `json:"active_disks"`
+	Degraded      int        `json:"degraded"`
+	SyncAction    string     `json:"sync_action"` // idle, resync, recover, check, repair, ...
+	SyncPercent   float64    `json:"sync_percent"`
+	SyncSpeedKBps int64      `json:"sync_speed_kbps"`
+	SyncFinishMin float64    `json:"sync_finish_min,omitempty"`
+	Members       []MDMember `json:"members"`
+}
+
+// mdstatMember matches a member entry such as "sdb1[1]" or "sdc1[2](F)".
+var mdstatMember = regexp.MustCompile(`^([^\[\s]+)\[(\d+)\]((?:\([A-Z]\))*)$`)
+
+// MDRaidCollector reports md arrays from /proc/mdstat and sysfs.
+type MDRaidCollector struct {
+	mu           sync.Mutex
+	procPath     string
+	sysBlockPath string
+	prev         map[string]MDArrayStats
+}
+
+// NewMDRaidCollector creates a new md RAID collector.
+func NewMDRaidCollector() *MDRaidCollector {
+	return &MDRaidCollector{
+		procPath:     "/proc",
+		sysBlockPath: "/sys/block",
+	}
+}
+
+// Collect returns the md arrays and a raid_degraded event for each array
+// that lost a member or started a rebuild since the last call. Arrays that
+// are already degraded when first seen (e.g. after an agent restart) raise
+// the event too.
+func (r *MDRaidCollector) Collect() ([]MDArrayStats, []Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	arrays := parseMDStat(filepath.Join(r.procPath, "mdstat"))
+	if len(arrays) == 0 {
+		r.prev = nil
+		return nil, nil
+	}
+
+	var events []Event
+	cur := make(map[string]MDArrayStats, len(arrays))
+
+	for i := range arrays {
+		a := &arrays[i]
+		r.readSysfs(a)
+		cur[a.Name] = *a
+
+		prev, seen := r.prev[a.Name]
+		var reason string
+		switch {
+		case a.Degraded > prev.Degraded:
+			reason = "member_lost"
+		case isRebuild(a.SyncAction) && (!seen || !isRebuild(prev.SyncAction)):
+			reason = "rebuild_started"
+		}
+
+		if reason != "" {
+			events = append(events, newEvent(EventRAIDDegraded, map[string]interface{}{
+				"array":        a.Name,
+				"level":        a.Level,
+				"reason":       reason,
+				"degraded":     a.Degraded,
+				"raid_disks":   a.RaidDisks,
+				"sync_action":  a.SyncAction,
+				"sync_percent": a.SyncPercent,
+			}))
+		}
+	}
+
+	r.prev = cur
+
+	return arrays, events
+}
+
+// isRebuild reports whether a sync_action restores redundancy. check and
+// repair are scrubs and not counted.
+func isRebuild(action string) bool {
+	return action == "recover" || action == "resync" || action == "reshape"
+}
+
+// parseMDStat parses /proc/mdstat. Example:
+//
+//	md1 : active raid5 sdd1[3] sdc1[1] sdb1[0](F)
+//	      585675776 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+//	      [==>..................]  recovery = 12.6% (37043392/292837888) finish=127.5min speed=33440K/sec
+func parseMDStat(path string) []MDArrayStats {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var arrays []MDArrayStats
+	var cur *MDArrayStats
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Array header: "md0 : active raid1 sdb1[1] sda1[0]"
+		if len(fields) >= 3 && strings.HasPrefix(fields[0], "md") && fields[1] == ":" {
+			arrays = append(arrays, MDArrayStats{Name: fields[0], State: fields[2]})
+			cur = &arrays[len(arrays)-1]
+
+			for _, f := range fields[3:] {
+				if strings.HasPrefix(f, "(") {
+					continue // "(auto-read-only)" and similar
+				}
+				m := mdstatMember.FindStringSubmatch(f)
+				if m == nil {
+					if cur.Level == "" {
+						cur.Level = f
+					}
+					continue
+				}
+				slot, _ := strconv.Atoi(m[2])
+				member := MDMember{Device: m[1], Slot: slot, State: "in_sync"}
+				switch {
+				case strings.Contains(m[3], "(F)"):
+					member.State = "faulty"
+				case strings.Contains(m[3], "(S)"):
+					member.State, member.Slot = "spare", -1
+				case strings.Contains(m[3], "(W)"):
+					member.State = "write_mostly"
+				}
+				cur.Members = append(cur.Members, member)
+			}
+			continue
+		}
+
+		if cur == nil {
+			continue
+		}
+
+		for _, f := range fields {
+			switch {
+			// "[3/2]": raid disks / active disks
+			case strings.HasPrefix(f, "[") && strings.Contains(f, "/") && strings.HasSuffix(f, "]"):
+				total, active, _ := strings.Cut(strings.Trim(f, "[]"), "/")
+				cur.RaidDisks, _ = strconv.Atoi(total)
+				cur.ActiveDisks, _ = strconv.Atoi(active)
+				cur.Degraded = cur.RaidDisks - cur.ActiveDisks
+			case strings.HasSuffix(f, "%"):
+				cur.SyncPercent, _ = strconv.ParseFloat(strings.TrimSuffix(f, "%"), 64)
+			case strings.HasPrefix(f, "finish="):
+				cur.SyncFinishMin, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(f, "finish="), "min"), 64)
+			case strings.HasPrefix(f, "speed="):
+				cur.SyncSpeedKBps, _ = strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(f, "speed="), "K/sec"), 10, 64)
+			case f == "recovery":
+				cur.SyncAction = "recover"
+			case f == "resync", f == "check", f == "repair", f == "reshape":
+				cur.SyncAction = f
+			}
+		}
+	}
+
+	for i := range arrays {
+		if arrays[i].SyncAction == "" {
+			arrays[i].SyncAction = "idle"
+		}
+		sort.Slice(arrays[i].Members, func(a, b int) bool {
+			return arrays[i].Members[a].Device < arrays[i].Members[b].Device
+		})
+	}
+
+	return arrays
+}
+
+// readSysfs overrides the mdstat values with the more precise ones from
+// /sys/block/<md>/md where available.
+func (r *MDRaidCollector) readSysfs(a *MDArrayStats) {
+	dir := filepath.Join(r.sysBlockPath, a.Name, "md")
+	if !fileExists(dir) {
+		return
+	}
+
+	if level := readString(filepath.Join(dir, "level")); level != "" {
+		a.Level = level
+	}
+	if state := readString(filepath.Join(dir, "array_state")); state != "" {
+		a.State = state
+	}
+	if v, ok := readInt(filepath.Join(dir, "raid_disks")); ok {
+		a.RaidDisks = int(v)
+	}
+	if v, ok := readInt(filepath.Join(dir, "degraded")); ok {
+		a.Degraded = int(v)
+		a.ActiveDisks = a.RaidDisks - a.Degraded
+	}
+	if action := readString(filepath.Join(dir, "sync_action")); action != "" {
+		a.SyncAction = action
+	}
+
+	if a.SyncAction != "idle" {
+		// sync_completed: "<done> / <total>" in sectors, or "none"
+		done, total, ok := strings.Cut(readString(filepath.Join(dir, "sync_completed")), " / ")
+		if ok {
+			d, _ := strconv.ParseFloat(done, 64)
+			t, _ := strconv.ParseFloat(total, 64)
+			if t > 0 {
+				a.SyncPercent = 100.0 * d / t
+			}
+		}
+		if v, ok := readInt(filepath.Join(dir, "sync_speed")); ok {
+			a.SyncSpeedKBps = v
+		}
+	}
+
+	// Member state: "in_sync", "faulty", "spare", "in_sync,write_mostly", ...
+	for i := range a.Members {
+		m := &a.Members[i]
+		if state := readString(filepath.Join(dir, "dev-"+m.Device, "state")); state != "" {
+			m.State = state
+		}
+		if slot := readString(filepath.Join(dir, "dev-"+m.Device, "slot")); slot == "none" {
+			m.Slot = -1
+		} else if v, err := strconv.Atoi(slot); err == nil {
+			m.Slot = v
+		}
+	}
+}
@@ -5,68 +5,160 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// CollectMemory reads /proc/meminfo and returns memory statistics in bytes.
-func CollectMemory() (used, available int64, percent float64, swapUsed int64) {
-	file, err := os.Open("/proc/meminfo")
+// EventOOMKill is raised when the kernel OOM killer killed a process.
+const EventOOMKill = "oom_kill"
+
+// MemoryStats holds the detailed /proc/meminfo breakdown and paging rates
+// from /proc/vmstat.
+type MemoryStats struct {
+	TotalBytes        int64 `json:"total_bytes"`
+	FreeBytes         int64 `json:"free_bytes"`
+	AvailableBytes    int64 `json:"available_bytes"`
+	UsedBytes         int64 `json:"used_bytes"` // total - available
+	BuffersBytes      int64 `json:"buffers_bytes"`
+	CachedBytes       int64 `json:"cached_bytes"`
+	SharedBytes       int64 `json:"shared_bytes"`
+	SlabBytes         int64 `json:"slab_bytes"`
+	SReclaimableBytes int64 `json:"sreclaimable_bytes"`
+	DirtyBytes        int64 `json:"dirty_bytes"`
+	WritebackBytes    int64 `json:"writeback_bytes"`
+	SwapTotalBytes    int64 `json:"swap_total_bytes"`
+	SwapFreeBytes     int64 `json:"swap_free_bytes"`
+	SwapUsedBytes     int64 `json:"swap_used_bytes"`
+	SwapCachedBytes   int64 `json:"swap_cached_bytes"`
+	HugePagesTotal    int64 `json:"hugepages_total"`
+	HugePagesFree     int64 `json:"hugepages_free"`
+	HugePagesReserved int64 `json:"hugepages_reserved"`
+	HugePageSizeBytes int64 `json:"hugepage_size_bytes"`
+
+	PageFaultsPerSec   float64 `json:"page_faults_per_sec"`
+	MajorFaultsPerSec  float64 `json:"major_faults_per_sec"`
+	SwapInPagesPerSec  float64 `json:"swap_in_pages_per_sec"`
+	SwapOutPagesPerSec float64 `json:"swap_out_pages_per_sec"`
+	OOMKills           uint64  `json:"oom_kills"` // since boot
+}
+
+// MemoryCollector reads /proc/meminfo and tracks /proc/vmstat counters
+// between samples.
+type MemoryCollector struct {
+	mu          sync.Mutex
+	meminfoPath string
+	vmstatPath  string
+	prev        map[string]uint64
+	prevTime    time.Time
+}
+
+// NewMemoryCollector creates a new memory collector.
+func NewMemoryCollector() *MemoryCollector {
+	m := &MemoryCollector{
+		meminfoPath: "/proc/meminfo",
+		vmstatPath:  "/proc/vmstat",
+	}
+	// Take an initial reading to establish baseline
+	m.prev = readFlatKeyed(m.vmstatPath)
+	m.prevTime = time.Now()
+	return m
+}
+
+// Collect returns the memory statistics and an oom_kill event if the OOM
+// killer was active since the last call.
+func (m *MemoryCollector) Collect() (*MemoryStats, []Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := readMeminfo(m.meminfoPath)
+	if len(info) == 0 {
+		return nil, nil
+	}
+
+	s := &MemoryStats{
+		TotalBytes:        info["MemTotal"],
+		FreeBytes:         info["MemFree"],
+		AvailableBytes:    info["MemAvailable"],
+		BuffersBytes:      info["Buffers"],
+		CachedBytes:       info["Cached"],
+		SharedBytes:       info["Shmem"],
+		SlabBytes:         info["Slab"],
+		SReclaimableBytes: info["SReclaimable"],
+		DirtyBytes:        info["Dirty"],
+		WritebackBytes:    info["Writeback"],
+		SwapTotalBytes:    info["SwapTotal"],
+		SwapFreeBytes:     info["SwapFree"],
+		SwapCachedBytes:   info["SwapCached"],
+		HugePagesTotal:    info["HugePages_Total"],
+		HugePagesFree:     info["HugePages_Free"],
+		HugePagesReserved: info["HugePages_Rsvd"],
+		HugePageSizeBytes: info["Hugepagesize"],
+	}
+
+	// Older kernels have no MemAvailable, estimate it
+	if s.AvailableBytes == 0 {
+		s.AvailableBytes = s.FreeBytes + s.BuffersBytes + s.CachedBytes
+	}
+	s.UsedBytes = s.TotalBytes - s.AvailableBytes
+	s.SwapUsedBytes = s.SwapTotalBytes - s.SwapFreeBytes
+
+	cur := readFlatKeyed(m.vmstatPath)
+	now := time.Now()
+	elapsed := now.Sub(m.prevTime).Seconds()
+
+	if elapsed > 0 {
+		s.PageFaultsPerSec = float64(sub(cur["pgfault"], m.prev["pgfault"])) / elapsed
+		s.MajorFaultsPerSec = float64(sub(cur["pgmajfault"], m.prev["pgmajfault"])) / elapsed
+		s.SwapInPagesPerSec = float64(sub(cur["pswpin"], m.prev["pswpin"])) / elapsed
+		s.SwapOutPagesPerSec = float64(sub(cur["pswpout"], m.prev["pswpout"])) / elapsed
+	}
+	s.OOMKills = cur["oom_kill"] // kernel 4.13+
+
+	var events []Event
+	if kills := sub(cur["oom_kill"], m.prev["oom_kill"]); kills > 0 {
+		events = append(events, newEvent(EventOOMKill, map[string]interface{}{
+			"count": kills,
+			"total": s.OOMKills,
+		}))
+	}
+
+	m.prev = cur
+	m.prevTime = now
+
+	return s, events
+}
+
+// readMeminfo parses /proc/meminfo into a map keyed by field name without
+// the colon. kB values are converted to bytes, HugePages_* are counts.
+func readMeminfo(path string) map[string]int64 {
+	values := make(map[string]int64)
+
+	file, err := os.Open(path)
 	if err != nil {
-		return 0, 0, 0, 0
+		return values
 	}
 	defer file.Close()
 
-	var memTotal, memFree, memAvailable, buffers, cached int64
-	var swapTotal, swapFree int64
-
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
+		fields := strings.Fields(scanner.Text())
 		if len(fields) < 2 {
 			continue
 		}
-
-		// Parse value (in kB)
 		value, err := strconv.ParseInt(fields[1], 10, 64)
 		if err != nil {
 			continue
 		}
-
-		switch fields[0] {
-		case "MemTotal:":
-			memTotal = value * 1024 // Convert kB to bytes
-		case "MemFree:":
-			memFree = value * 1024
-		case "MemAvailable:":
-			memAvailable = value * 1024
-		case "Buffers:":
-			buffers = value * 1024
-		case "Cached:":
-			cached = value * 1024
-		case "SwapTotal:":
-			swapTotal = value * 1024
-		case "SwapFree:":
-			swapFree = value * 1024
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
 		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
 	}
 
-	// If MemAvailable is not available (older kernels), estimate it
-	if memAvailable == 0 && memTotal > 0 {
-		memAvailable = memFree + buffers + cached
-	}
-
-	// Calculate used memory
-	// Used = Total - Available
-	used = memTotal - memAvailable
-	available = memAvailable
-
-	// Calculate percentage
-	if memTotal > 0 {
-		percent = 100.0 * float64(used) / float64(memTotal)
-	}
-
-	// Calculate swap used
-	swapUsed = swapTotal - swapFree
+	return values
+}
 
-	return used, available, percent, swapUsed
+// memTotalBytes returns MemTotal from /proc/meminfo in bytes.
+func memTotalBytes() int64 {
+	return readMeminfo("/proc/meminfo")["MemTotal"]
 }
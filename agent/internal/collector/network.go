@@ -3,16 +3,202 @@ package collector
 import (
 	"bufio"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// CollectNetwork reads /proc/net/dev and returns total RX and TX bytes
-// across all interfaces (excluding loopback).
-func CollectNetwork() (rxBytes, txBytes int64) {
-	file, err := os.Open("/proc/net/dev")
+// Interface classes reported in NetInterfaceStats.Type.
+const (
+	IfacePhysical = "physical"
+	IfaceBridge   = "bridge"
+	IfaceBond     = "bond"
+	IfaceVLAN     = "vlan"
+	IfaceVirtual  = "virtual"
+)
+
+// NetInterfaceStats holds counters, rates and link state for one interface.
+type NetInterfaceStats struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	OperState      string `json:"operstate"`
+	SpeedMbps      int64  `json:"speed_mbps"` // -1 if unknown (link down, virtual)
+	MTU            int64  `json:"mtu"`
+	MAC            string `json:"mac"`
+	CarrierChanges int64  `json:"carrier_changes"`
+
+	RXBytes   int64 `json:"rx_bytes"`
+	TXBytes   int64 `json:"tx_bytes"`
+	RXPackets int64 `json:"rx_packets"`
+	TXPackets int64 `json:"tx_packets"`
+	RXErrors  int64 `json:"rx_errors"`
+	TXErrors  int64 `json:"tx_errors"`
+	RXDropped int64 `json:"rx_dropped"`
+	TXDropped int64 `json:"tx_dropped"`
+
+	RXBytesPerSec   float64 `json:"rx_bytes_per_sec"`
+	TXBytesPerSec   float64 `json:"tx_bytes_per_sec"`
+	RXPacketsPerSec float64 `json:"rx_packets_per_sec"`
+	TXPacketsPerSec float64 `json:"tx_packets_per_sec"`
+}
+
+// netCounters holds the raw /proc/net/dev counters of one interface.
+type netCounters struct {
+	rxBytes, rxPackets, rxErrors, rxDropped int64
+	txBytes, txPackets, txErrors, txDropped int64
+}
+
+// NetworkCollector tracks per-interface traffic between samples.
+type NetworkCollector struct {
+	mu         sync.Mutex
+	netDevPath string
+	sysNetPath string
+	prev       map[string]netCounters
+	prevTime   time.Time
+}
+
+// NewNetworkCollector creates a new network collector.
+func NewNetworkCollector() *NetworkCollector {
+	n := &NetworkCollector{
+		netDevPath: "/proc/net/dev",
+		sysNetPath: "/sys/class/net",
+	}
+	// Take an initial reading to establish baseline
+	n.prev, _ = readNetDev(n.netDevPath)
+	n.prevTime = time.Now()
+	return n
+}
+
+// Collect returns statistics for all interfaces except loopback.
+func (n *NetworkCollector) Collect() []NetInterfaceStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	cur, order := readNetDev(n.netDevPath)
+	now := time.Now()
+	elapsed := now.Sub(n.prevTime).Seconds()
+
+	var result []NetInterfaceStats
+	for _, iface := range order {
+		if iface == "lo" {
+			continue
+		}
+
+		c := cur[iface]
+		s := NetInterfaceStats{
+			Name:      iface,
+			RXBytes:   c.rxBytes,
+			TXBytes:   c.txBytes,
+			RXPackets: c.rxPackets,
+			TXPackets: c.txPackets,
+			RXErrors:  c.rxErrors,
+			TXErrors:  c.txErrors,
+			RXDropped: c.rxDropped,
+			TXDropped: c.txDropped,
+		}
+
+		if p, ok := n.prev[iface]; ok && elapsed > 0 {
+			s.RXBytesPerSec = counterRate(p.rxBytes, c.rxBytes, elapsed)
+			s.TXBytesPerSec = counterRate(p.txBytes, c.txBytes, elapsed)
+			s.RXPacketsPerSec = counterRate(p.rxPackets, c.rxPackets, elapsed)
+			s.TXPacketsPerSec = counterRate(p.txPackets, c.txPackets, elapsed)
+		}
+
+		n.readLinkInfo(&s)
+		result = append(result, s)
+	}
+
+	n.prev = cur
+	n.prevTime = now
+
+	return result
+}
+
+// readLinkInfo fills in link metadata and the interface class from sysfs.
+func (n *NetworkCollector) readLinkInfo(s *NetInterfaceStats) {
+	dir := filepath.Join(n.sysNetPath, s.Name)
+
+	s.OperState = readString(filepath.Join(dir, "operstate"))
+	s.MAC = readString(filepath.Join(dir, "address"))
+	s.MTU, _ = readInt(filepath.Join(dir, "mtu"))
+	s.CarrierChanges, _ = readInt(filepath.Join(dir, "carrier_changes"))
+
+	// Reading speed fails with EINVAL while the link is down
+	s.SpeedMbps = -1
+	if speed, ok := readInt(filepath.Join(dir, "speed")); ok && speed > 0 {
+		s.SpeedMbps = speed
+	}
+
+	s.Type = classifyInterface(dir)
+}
+
+// classifyInterface determines the interface class from its sysfs directory.
+func classifyInterface(dir string) string {
+	switch {
+	case fileExists(filepath.Join(dir, "bridge")):
+		return IfaceBridge
+	case fileExists(filepath.Join(dir, "bonding")):
+		return IfaceBond
+	}
+
+	for _, line := range strings.Split(readString(filepath.Join(dir, "uevent")), "\n") {
+		if line == "DEVTYPE=vlan" {
+			return IfaceVLAN
+		}
+	}
+
+	// Only interfaces backed by a device (PCI, USB, virtio, SDIO) are physical
+	if fileExists(filepath.Join(dir, "device")) {
+		return IfacePhysical
+	}
+
+	return IfaceVirtual
+}
+
+// sumPhysical returns the total RX and TX bytes of all physical interfaces.
+// Bridges, taps and veths only carry traffic that already passed a physical
+// uplink, so counting them would count it twice. Hosts without any physical
+// interface (containers) fall back to the sum of all interfaces.
+func sumPhysical(ifaces []NetInterfaceStats) (rxBytes, txBytes int64) {
+	found := false
+	for _, s := range ifaces {
+		if s.Type == IfacePhysical {
+			rxBytes += s.RXBytes
+			txBytes += s.TXBytes
+			found = true
+		}
+	}
+	if found {
+		return rxBytes, txBytes
+	}
+
+	for _, s := range ifaces {
+		rxBytes += s.RXBytes
+		txBytes += s.TXBytes
+	}
+	return rxBytes, txBytes
+}
+
+// counterRate returns the per-second increase of a counter, treating a
+// counter reset as no traffic.
+func counterRate(prev, cur int64, elapsed float64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / elapsed
+}
+
+// readNetDev parses /proc/net/dev. It returns the counters keyed by interface
+// name and the interface names in file order.
+func readNetDev(filename string) (map[string]netCounters, []string) {
+	counters := make(map[string]netCounters)
+	var order []string
+
+	file, err := os.Open(filename)
 	if err != nil {
-		return 0, 0
+		return counters, order
 	}
 	defer file.Close()
 
@@ -35,30 +221,29 @@ func CollectNetwork() (rxBytes, txBytes int64) {
 
 		iface := strings.TrimSpace(line[:colonIdx])
 
-		// Skip loopback interface
-		if iface == "lo" {
-			continue
-		}
-
-		// Parse the values after the colon
 		// Format: bytes packets errs drop fifo frame compressed multicast | bytes packets errs drop fifo colls carrier compressed
 		values := strings.Fields(line[colonIdx+1:])
-		if len(values) < 9 {
+		if len(values) < 12 {
 			continue
 		}
 
-		// RX bytes is the first value
-		rx, err := strconv.ParseInt(values[0], 10, 64)
-		if err == nil {
-			rxBytes += rx
+		v := func(i int) int64 {
+			n, _ := strconv.ParseInt(values[i], 10, 64)
+			return n
 		}
 
-		// TX bytes is the 9th value (index 8)
-		tx, err := strconv.ParseInt(values[8], 10, 64)
-		if err == nil {
-			txBytes += tx
+		counters[iface] = netCounters{
+			rxBytes:   v(0),
+			rxPackets: v(1),
+			rxErrors:  v(2),
+			rxDropped: v(3),
+			txBytes:   v(8),
+			txPackets: v(9),
+			txErrors:  v(10),
+			txDropped: v(11),
 		}
+		order = append(order, iface)
 	}
 
-	return rxBytes, txBytes
+	return counters, order
 }
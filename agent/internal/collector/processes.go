@@ -1,30 +1,417 @@
 package collector
 
 import (
+	"bufio"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
 )
 
-// CollectProcesses counts the number of running processes by counting
-// numeric directories in /proc (each PID has a directory).
-func CollectProcesses() int {
-	entries, err := os.ReadDir("/proc")
+// topSampleWindow is the measuring window of on-demand top lists. It is
+// long enough that a single clock tick is not reported as a busy process.
+const topSampleWindow = time.Second
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/[pid]/stat.
+// It is 100 on every Linux architecture we build for.
+const clockTicks = 100
+
+// ProcessInfo describes a single process in the top lists.
+type ProcessInfo struct {
+	PID        int     `json:"pid"`
+	Name       string  `json:"name"`
+	Cmdline    string  `json:"cmdline"`
+	User       string  `json:"user"`
+	State      string  `json:"state"`
+	CPUPercent float64 `json:"cpu_percent"` // 100 = one full core, like top
+	RSSBytes   int64   `json:"rss_bytes"`
+	MemPercent float64 `json:"mem_percent"`
+	Threads    int     `json:"threads"`
+}
+
+// ProcessStates breaks the process count down by scheduler state.
+type ProcessStates struct {
+	Total           int     `json:"total"`
+	Running         int     `json:"running"`         // R
+	Sleeping        int     `json:"sleeping"`        // S
+	Uninterruptible int     `json:"uninterruptible"` // D, usually waiting for I/O
+	Zombie          int     `json:"zombie"`          // Z
+	Stopped         int     `json:"stopped"`         // T, t
+	Idle            int     `json:"idle"`            // I, idle kernel threads
+	Threads         int     `json:"threads"`
+	ForksPerSec     float64 `json:"forks_per_sec"`
+}
+
+// TopProcesses holds the processes using the most CPU and memory.
+type TopProcesses struct {
+	ByCPU    []ProcessInfo `json:"by_cpu"`
+	ByMemory []ProcessInfo `json:"by_memory"`
+}
+
+// procSample is the per-process data read on every collection.
+type procSample struct {
+	pid       int
+	name      string
+	state     string
+	cpuTicks  uint64
+	startTime uint64
+	threads   int
+	rssBytes  int64
+	cpu       float64
+}
+
+// ProcessCollector samples /proc/[pid] between calls to compute per-process
+// CPU usage.
+type ProcessCollector struct {
+	mu         sync.Mutex
+	procPath   string
+	statPath   string
+	passwdPath string
+	cfg        config.ProcessConfig
+	pageSize   int64
+	prev       map[int]procSample
+	prevForks  uint64
+	prevTime   time.Time
+	users      map[string]string
+}
+
+// NewProcessCollector creates a new process collector.
+func NewProcessCollector(cfg config.ProcessConfig) *ProcessCollector {
+	p := &ProcessCollector{
+		procPath:   "/proc",
+		statPath:   "/proc/stat",
+		passwdPath: "/etc/passwd",
+		cfg:        cfg,
+		pageSize:   int64(os.Getpagesize()),
+	}
+	// Take an initial reading to establish baseline
+	p.prev = p.sample()
+	p.prevForks = readForks(p.statPath)
+	p.prevTime = time.Now()
+	return p
+}
+
+// Collect is the periodic sample: it returns the state breakdown and the
+// configured top_n processes by CPU and memory. Only Collect advances the
+// CPU baseline and the fork counter, so on-demand requests (Top) do not
+// shorten the measuring window of the next push.
+func (p *ProcessCollector) Collect() (*ProcessStates, *TopProcesses) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cur := p.sample()
+	forks := readForks(p.statPath)
+	now := time.Now()
+	elapsed := now.Sub(p.prevTime).Seconds()
+
+	samples := cpuUsage(cur, p.prev, elapsed)
+	states := &ProcessStates{Total: len(samples)}
+	for _, s := range samples {
+		states.count(s)
+	}
+
+	if elapsed > 0 && forks >= p.prevForks {
+		states.ForksPerSec = float64(forks-p.prevForks) / elapsed
+	}
+
+	p.prev = cur
+	p.prevForks = forks
+	p.prevTime = now
+
+	return states, p.top(samples, p.cfg.TopN)
+}
+
+// Top returns the top n processes by CPU and memory for on-demand requests.
+// CPU usage is measured over its own topSampleWindow, so the baseline of
+// the periodic Collect is left alone. n <= 0 uses the configured top_n.
+func (p *ProcessCollector) Top(n int) *TopProcesses {
+	// Sample without the lock, a push must not wait for the window
+	start := time.Now()
+	first := p.sample()
+	time.Sleep(topSampleWindow)
+	cur := p.sample()
+	elapsed := time.Since(start).Seconds()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n <= 0 {
+		n = p.cfg.TopN
+	}
+	return p.top(cpuUsage(cur, first, elapsed), n)
+}
+
+// cpuUsage returns the samples of cur with their CPU usage since prev,
+// elapsed seconds earlier.
+func cpuUsage(cur, prev map[int]procSample, elapsed float64) []procSample {
+	samples := make([]procSample, 0, len(cur))
+	for pid, s := range cur {
+		// A different start time means the PID was reused
+		if old, ok := prev[pid]; ok && old.startTime == s.startTime && elapsed > 0 {
+			s.cpu = 100.0 * float64(sub(s.cpuTicks, old.cpuTicks)) / clockTicks / elapsed
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// top builds the top n lists by CPU and memory. It sorts samples in place
+// and must be called with p.mu held.
+func (p *ProcessCollector) top(samples []procSample, n int) *TopProcesses {
+	memTotal := memTotalBytes()
+	top := &TopProcesses{}
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].cpu != samples[j].cpu {
+			return samples[i].cpu > samples[j].cpu
+		}
+		return samples[i].rssBytes > samples[j].rssBytes
+	})
+	for i := 0; i < len(samples) && i < n; i++ {
+		top.ByCPU = append(top.ByCPU, p.describe(samples[i], memTotal))
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].rssBytes != samples[j].rssBytes {
+			return samples[i].rssBytes > samples[j].rssBytes
+		}
+		return samples[i].cpu > samples[j].cpu
+	})
+	for i := 0; i < len(samples) && i < n; i++ {
+		top.ByMemory = append(top.ByMemory, p.describe(samples[i], memTotal))
+	}
+
+	return top
+}
+
+// count adds a process to the state breakdown.
+func (ps *ProcessStates) count(s procSample) {
+	ps.Threads += s.threads
+
+	switch s.state {
+	case "R":
+		ps.Running++
+	case "S":
+		ps.Sleeping++
+	case "D":
+		ps.Uninterruptible++
+	case "Z":
+		ps.Zombie++
+	case "T", "t":
+		ps.Stopped++
+	case "I":
+		ps.Idle++
+	}
+}
+
+// describe builds the reported process info, reading the more expensive
+// details (command line, owner) only for processes that made the list.
+func (p *ProcessCollector) describe(s procSample, memTotal int64) ProcessInfo {
+	dir := filepath.Join(p.procPath, strconv.Itoa(s.pid))
+
+	info := ProcessInfo{
+		PID:        s.pid,
+		Name:       s.name,
+		State:      s.state,
+		CPUPercent: s.cpu,
+		RSSBytes:   s.rssBytes,
+		Threads:    s.threads,
+		Cmdline:    p.readCmdline(dir, s.name),
+		User:       p.userName(readStatusField(filepath.Join(dir, "status"), "Uid:")),
+	}
+	if memTotal > 0 {
+		info.MemPercent = 100.0 * float64(s.rssBytes) / float64(memTotal)
+	}
+
+	return info
+}
+
+// sample reads stat and statm of all processes.
+func (p *ProcessCollector) sample() map[int]procSample {
+	samples := make(map[int]procSample)
+
+	entries, err := os.ReadDir(p.procPath)
 	if err != nil {
-		return 0
+		return samples
 	}
 
-	count := 0
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
 		}
 
 		// Check if the directory name is a number (PID)
-		name := entry.Name()
-		if _, err := strconv.Atoi(name); err == nil {
-			count++
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// The process may exit at any point, skip it then
+		s, ok := p.readStat(pid)
+		if !ok {
+			continue
+		}
+		samples[pid] = s
+	}
+
+	return samples
+}
+
+// readStat parses /proc/[pid]/stat and /proc/[pid]/statm.
+func (p *ProcessCollector) readStat(pid int) (procSample, bool) {
+	dir := filepath.Join(p.procPath, strconv.Itoa(pid))
+
+	data, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return procSample{}, false
+	}
+
+	// Format: "pid (comm) state ppid ...". comm may contain spaces and
+	// parentheses, so split at the last ')'.
+	line := string(data)
+	start := strings.IndexByte(line, '(')
+	end := strings.LastIndexByte(line, ')')
+	if start == -1 || end < start {
+		return procSample{}, false
+	}
+
+	// fields[0] is state (field 3 in proc(5)), so field N is fields[N-3]
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 20 {
+		return procSample{}, false
+	}
+
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.Atoi(fields[17])
+	startTime, _ := strconv.ParseUint(fields[19], 10, 64)
+
+	s := procSample{
+		pid:       pid,
+		name:      line[start+1 : end],
+		state:     fields[0],
+		cpuTicks:  utime + stime,
+		startTime: startTime,
+		threads:   threads,
+	}
+
+	// statm: size resident shared text lib data dt (in pages)
+	if statm, err := os.ReadFile(filepath.Join(dir, "statm")); err == nil {
+		if f := strings.Fields(string(statm)); len(f) >= 2 {
+			rss, _ := strconv.ParseInt(f[1], 10, 64)
+			s.rssBytes = rss * p.pageSize
+		}
+	}
+
+	return s, true
+}
+
+// readCmdline returns the command line of a process, truncated to the
+// configured length. Kernel threads have none and are shown as [name].
+func (p *ProcessCollector) readCmdline(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil || len(data) == 0 {
+		return "[" + name + "]"
+	}
+
+	cmdline := strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+
+	if limit := p.cfg.CmdlineLength; limit > 0 && len(cmdline) > limit {
+		// Don't split a multi-byte character
+		for limit > 0 && !utf8.RuneStart(cmdline[limit]) {
+			limit--
+		}
+		cmdline = cmdline[:limit]
+	}
+
+	return cmdline
+}
+
+// userName resolves a UID to a user name via /etc/passwd. The file is
+// re-read when an unknown UID shows up.
+func (p *ProcessCollector) userName(uid string) string {
+	if uid == "" {
+		return ""
+	}
+	if name, ok := p.users[uid]; ok {
+		return name
+	}
+
+	p.users = readPasswd(p.passwdPath)
+	if name, ok := p.users[uid]; ok {
+		return name
+	}
+
+	// Remember unknown UIDs (e.g. from containers) to avoid re-reading
+	p.users[uid] = uid
+	return uid
+}
+
+// readPasswd returns a UID to user name map from a passwd file.
+func readPasswd(path string) map[string]string {
+	users := make(map[string]string)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return users
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Format: name:password:uid:gid:gecos:home:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) >= 3 {
+			users[fields[2]] = fields[0]
+		}
+	}
+
+	return users
+}
+
+// readForks returns the number of forks since boot from the "processes"
+// line of /proc/stat.
+func readForks(path string) uint64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "processes" {
+			v, _ := strconv.ParseUint(fields[1], 10, 64)
+			return v
+		}
+	}
+
+	return 0
+}
+
+// readStatusField returns the first value of a key in /proc/[pid]/status,
+// e.g. the real UID for "Uid:".
+func readStatusField(path, key string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == key {
+			return fields[1]
 		}
 	}
 
-	return count
+	return ""
 }
@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+func TestReadCmdline(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, "1/cmdline", "/usr/bin/python3\x00-m\x00http.server\x00")
+	writeFixture(t, root, "2/cmdline", "")
+	// "ü" is two bytes, the limit falls between them
+	writeFixture(t, root, "3/cmdline", "/opt/grüße\x00--flag\x00")
+
+	tests := []struct {
+		dir   string
+		limit int
+		want  string
+	}{
+		{"1", 0, "/usr/bin/python3 -m http.server"},
+		{"1", 16, "/usr/bin/python3"},
+		{"2", 0, "[kthreadd]"},
+		{"3", 8, "/opt/gr"},
+		{"3", 9, "/opt/grü"},
+	}
+	for _, tt := range tests {
+		p := &ProcessCollector{cfg: config.ProcessConfig{CmdlineLength: tt.limit}}
+		got := p.readCmdline(filepath.Join(root, tt.dir), "kthreadd")
+		if got != tt.want {
+			t.Errorf("readCmdline(%s, limit %d) = %q, want %q", tt.dir, tt.limit, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("readCmdline(%s, limit %d) = %q is not valid UTF-8", tt.dir, tt.limit, got)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// Guest types reported in GuestStats.Type, named like in the Proxmox API.
+const (
+	GuestVM = "qemu"
+	GuestCT = "lxc"
+)
+
+// GuestStats holds status and resource usage of a Proxmox VM or container.
+// Network figures are from the guest's point of view: NetIn is what the
+// guest received, i.e. what the host sent into its tap/veth interfaces.
+type GuestStats struct {
+	VMID                 int     `json:"vmid"`
+	Type                 string  `json:"type"`
+	Name                 string  `json:"name"`
+	Status               string  `json:"status"`      // running or stopped
+	CPUPercent           float64 `json:"cpu_percent"` // 100 = one full core
+	MemoryBytes          int64   `json:"memory_bytes"`
+	MemoryMaxBytes       int64   `json:"memory_max_bytes"`
+	DiskReadBytesPerSec  float64 `json:"disk_read_bytes_per_sec"`
+	DiskWriteBytesPerSec float64 `json:"disk_write_bytes_per_sec"`
+	NetInBytes           int64   `json:"net_in_bytes"`
+	NetOutBytes          int64   `json:"net_out_bytes"`
+	NetInBytesPerSec     float64 `json:"net_in_bytes_per_sec"`
+	NetOutBytesPerSec    float64 `json:"net_out_bytes_per_sec"`
+}
+
+// ProxmoxStats holds the guests of a Proxmox VE node.
+type ProxmoxStats struct {
+	VMsRunning int          `json:"vms_running"`
+	CTsRunning int          `json:"cts_running"`
+	Guests     []GuestStats `json:"guests"`
+}
+
+// ProxmoxCollector reports the guests of the local Proxmox VE node without
+// going through pvesh.
+type ProxmoxCollector struct {
+	pvePath        string
+	runPath        string
+	procPath       string
+	cgroupPath     string
+	pveversionPath string
+}
+
+// NewProxmoxCollector creates a Proxmox collector.
+func NewProxmoxCollector(cfg config.ProxmoxConfig) *ProxmoxCollector {
+	return &ProxmoxCollector{
+		pvePath:        cfg.PVEPath,
+		runPath:        cfg.RunPath,
+		procPath:       cfg.ProcPath,
+		cgroupPath:     cfg.CgroupPath,
+		pveversionPath: "/usr/bin/pveversion",
+	}
+}
+
+// IsProxmox reports whether this host is a Proxmox VE node.
+func (p *ProxmoxCollector) IsProxmox() bool {
+	return fileExists(filepath.Join(p.pvePath, "qemu-server")) || fileExists(p.pveversionPath)
+}
+
+// Collect returns the guests of this node. Per-guest usage is taken from
+// the already collected cgroup and interface stats. It returns nil on hosts
+// that are not Proxmox VE nodes.
+func (p *ProxmoxCollector) Collect(cgroups []CgroupStats, ifaces []NetInterfaceStats) *ProxmoxStats {
+	if !p.IsProxmox() {
+		return nil
+	}
+
+	stats := &ProxmoxStats{}
+
+	// /etc/pve/qemu-server and /etc/pve/lxc link to the local node's guests
+	for guestType, confDir := range map[string]string{GuestVM: "qemu-server", GuestCT: "lxc"} {
+		confs, _ := filepath.Glob(filepath.Join(p.pvePath, confDir, "*.conf"))
+
+		for _, conf := range confs {
+			vmid, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(conf), ".conf"))
+			if err != nil {
+				continue
+			}
+
+			g := GuestStats{
+				VMID:   vmid,
+				Type:   guestType,
+				Name:   guestName(conf, guestType),
+				Status: "stopped",
+			}
+
+			if p.isRunning(g) {
+				g.Status = "running"
+				if guestType == GuestVM {
+					stats.VMsRunning++
+				} else {
+					stats.CTsRunning++
+				}
+				guestUsage(&g, cgroups, ifaces)
+			}
+
+			stats.Guests = append(stats.Guests, g)
+		}
+	}
+
+	sort.Slice(stats.Guests, func(i, j int) bool { return stats.Guests[i].VMID < stats.Guests[j].VMID })
+
+	return stats
+}
+
+// isRunning checks the qemu-server PID file for VMs and the cgroup for
+// containers.
+func (p *ProxmoxCollector) isRunning(g GuestStats) bool {
+	id := strconv.Itoa(g.VMID)
+
+	if g.Type == GuestCT {
+		root := findCgroup2Root(p.cgroupPath)
+		if root == "" {
+			root = p.cgroupPath
+		}
+		return fileExists(filepath.Join(root, "lxc", id))
+	}
+
+	pid := readString(filepath.Join(p.runPath, "qemu-server", id+".pid"))
+	if pid == "" {
+		return false
+	}
+	// A stale PID file survives a crash, so check the process too
+	return fileExists(filepath.Join(p.procPath, pid))
+}
+
+// guestUsage fills in CPU, memory and disk I/O from the guest's cgroup and
+// network traffic from its tap (VM) or veth (CT) interfaces.
+func guestUsage(g *GuestStats, cgroups []CgroupStats, ifaces []NetInterfaceStats) {
+	id := strconv.Itoa(g.VMID)
+
+	for _, cg := range cgroups {
+		if cg.Kind != g.Type || cg.Name != id {
+			continue
+		}
+		g.CPUPercent = cg.CPUPercent
+		g.MemoryBytes = cg.MemoryBytes
+		g.MemoryMaxBytes = cg.MemoryMaxBytes
+		g.DiskReadBytesPerSec = cg.IOReadBytesPerSec
+		g.DiskWriteBytesPerSec = cg.IOWriteBytesPerSec
+		break
+	}
+
+	// Interfaces are named tap<vmid>i<n> and veth<vmid>i<n>
+	prefix := "tap" + id + "i"
+	if g.Type == GuestCT {
+		prefix = "veth" + id + "i"
+	}
+
+	for _, iface := range ifaces {
+		if !strings.HasPrefix(iface.Name, prefix) {
+			continue
+		}
+		// What the host transmits on the interface, the guest receives
+		g.NetInBytes += iface.TXBytes
+		g.NetOutBytes += iface.RXBytes
+		g.NetInBytesPerSec += iface.TXBytesPerSec
+		g.NetOutBytesPerSec += iface.RXBytesPerSec
+	}
+}
+
+// guestName reads the VM name ("name:") or container hostname ("hostname:")
+// from a guest config. Snapshot sections further down are ignored.
+func guestName(conf, guestType string) string {
+	file, err := os.Open(conf)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	key := "name:"
+	if guestType == GuestCT {
+		key = "hostname:"
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if strings.HasPrefix(line, key) {
+			return strings.TrimSpace(strings.TrimPrefix(line, key))
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// writeFixture creates a file and its parent directories below root.
+func writeFixture(t *testing.T, root, path, content string) {
+	t.Helper()
+
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProxmoxCollect(t *testing.T) {
+	root := t.TempDir()
+
+	// VM 100 is running, VM 101 has a stale PID file, CT 200 is running and
+	// CT 201 is stopped
+	writeFixture(t, root, "pve/qemu-server/100.conf", "name: web\nmemory: 2048\n\n[snap1]\nname: old\n")
+	writeFixture(t, root, "pve/qemu-server/101.conf", "name: crashed\n")
+	writeFixture(t, root, "pve/lxc/200.conf", "hostname: dns\n")
+	writeFixture(t, root, "pve/lxc/201.conf", "hostname: spare\n")
+	writeFixture(t, root, "run/qemu-server/100.pid", "4242\n")
+	writeFixture(t, root, "run/qemu-server/101.pid", "4343\n")
+	writeFixture(t, root, "proc/4242/stat", "4242 (kvm) S\n")
+	writeFixture(t, root, "cgroup/cgroup.controllers", "cpu memory io\n")
+	writeFixture(t, root, "cgroup/lxc/200/cgroup.procs", "")
+
+	p := NewProxmoxCollector(config.ProxmoxConfig{
+		PVEPath:    filepath.Join(root, "pve"),
+		RunPath:    filepath.Join(root, "run"),
+		ProcPath:   filepath.Join(root, "proc"),
+		CgroupPath: filepath.Join(root, "cgroup"),
+	})
+
+	cgroups := []CgroupStats{
+		{Kind: GuestVM, Name: "100", CPUPercent: 50, MemoryBytes: 1024, MemoryMaxBytes: 2048},
+		{Kind: GuestCT, Name: "200", CPUPercent: 5, MemoryBytes: 512},
+	}
+	ifaces := []NetInterfaceStats{
+		{Name: "tap100i0", RXBytes: 100, TXBytes: 200},
+		{Name: "tap100i1", RXBytes: 1, TXBytes: 2},
+		{Name: "veth200i0", RXBytes: 30, TXBytes: 40},
+	}
+
+	stats := p.Collect(cgroups, ifaces)
+	if stats == nil {
+		t.Fatal("Collect returned nil")
+	}
+	if stats.VMsRunning != 1 || stats.CTsRunning != 1 {
+		t.Errorf("running = %d VMs, %d CTs, want 1, 1", stats.VMsRunning, stats.CTsRunning)
+	}
+
+	want := []struct {
+		vmid         int
+		guestType    string
+		name, status string
+	}{
+		{100, GuestVM, "web", "running"},
+		{101, GuestVM, "crashed", "stopped"},
+		{200, GuestCT, "dns", "running"},
+		{201, GuestCT, "spare", "stopped"},
+	}
+	if len(stats.Guests) != len(want) {
+		t.Fatalf("got %d guests, want %d", len(stats.Guests), len(want))
+	}
+	for i, w := range want {
+		g := stats.Guests[i]
+		if g.VMID != w.vmid || g.Type != w.guestType || g.Name != w.name || g.Status != w.status {
+			t.Errorf("guest %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	vm := stats.Guests[0]
+	if vm.CPUPercent != 50 || vm.MemoryBytes != 1024 || vm.MemoryMaxBytes != 2048 {
+		t.Errorf("VM usage = %+v", vm)
+	}
+	// The guest receives what the host transmits on the tap interfaces
+	if vm.NetInBytes != 202 || vm.NetOutBytes != 101 {
+		t.Errorf("VM network in/out = %d/%d, want 202/101", vm.NetInBytes, vm.NetOutBytes)
+	}
+
+	ct := stats.Guests[2]
+	if ct.CPUPercent != 5 || ct.NetInBytes != 40 || ct.NetOutBytes != 30 {
+		t.Errorf("CT usage = %+v", ct)
+	}
+
+	// Stopped guests have no usage
+	if stale := stats.Guests[1]; stale.CPUPercent != 0 || stale.NetInBytes != 0 {
+		t.Errorf("stopped VM usage = %+v", stale)
+	}
+}
+
+func TestProxmoxCollectNotProxmox(t *testing.T) {
+	root := t.TempDir()
+	p := NewProxmoxCollector(config.ProxmoxConfig{
+		PVEPath:    filepath.Join(root, "pve"),
+		RunPath:    filepath.Join(root, "run"),
+		ProcPath:   filepath.Join(root, "proc"),
+		CgroupPath: filepath.Join(root, "cgroup"),
+	})
+	p.pveversionPath = filepath.Join(root, "usr/bin/pveversion")
+
+	if stats := p.Collect(nil, nil); stats != nil {
+		t.Errorf("Collect = %+v, want nil", stats)
+	}
+
+	// Nodes without guests have no qemu-server directory
+	writeFixture(t, root, "usr/bin/pveversion", "#!/bin/sh\n")
+	if stats := p.Collect(nil, nil); stats == nil || len(stats.Guests) != 0 {
+		t.Errorf("Collect = %+v, want no guests", stats)
+	}
+}
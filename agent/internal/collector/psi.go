@@ -0,0 +1,192 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PSIValues holds one "some" or "full" line of a pressure file.
+// StallUsec is the stall time accumulated since the previous sample.
+type PSIValues struct {
+	Avg10     float64 `json:"avg10"`
+	Avg60     float64 `json:"avg60"`
+	Avg300    float64 `json:"avg300"`
+	TotalUsec uint64  `json:"total_usec"`
+	StallUsec uint64  `json:"stall_usec"`
+}
+
+// PSIResource holds the pressure of a single resource (cpu, memory or io).
+type PSIResource struct {
+	Some PSIValues  `json:"some"`
+	Full *PSIValues `json:"full,omitempty"` // not reported for cpu on older kernels
+}
+
+// CgroupPSI holds the pressure of one cgroup.
+type CgroupPSI struct {
+	Cgroup string       `json:"cgroup"`
+	CPU    *PSIResource `json:"cpu,omitempty"`
+	Memory *PSIResource `json:"memory,omitempty"`
+	IO     *PSIResource `json:"io,omitempty"`
+}
+
+// PSIStats holds system-wide and per-cgroup Pressure Stall Information.
+type PSIStats struct {
+	CPU     *PSIResource `json:"cpu,omitempty"`
+	Memory  *PSIResource `json:"memory,omitempty"`
+	IO      *PSIResource `json:"io,omitempty"`
+	Cgroups []CgroupPSI  `json:"cgroups,omitempty"`
+}
+
+// psiCgroupDepth limits how deep the cgroup tree is walked, so that
+// e.g. system.slice/ssh.service is reported but not every sub-scope.
+const psiCgroupDepth = 2
+
+// PSICollector reads /proc/pressure and cgroup v2 pressure files.
+type PSICollector struct {
+	mu           sync.Mutex
+	pressurePath string
+	cgroupPath   string
+	prevTotals   map[string]uint64
+}
+
+// NewPSICollector creates a new PSI collector.
+func NewPSICollector() *PSICollector {
+	return &PSICollector{
+		pressurePath: "/proc/pressure",
+		cgroupPath:   "/sys/fs/cgroup",
+		prevTotals:   make(map[string]uint64),
+	}
+}
+
+// Collect returns the current pressure figures, or nil if the kernel has
+// no PSI support (CONFIG_PSI disabled or psi=0 on the command line).
+func (p *PSICollector) Collect() *PSIStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	totals := make(map[string]uint64)
+
+	stats := &PSIStats{
+		CPU:    p.readPressure(filepath.Join(p.pressurePath, "cpu"), totals),
+		Memory: p.readPressure(filepath.Join(p.pressurePath, "memory"), totals),
+		IO:     p.readPressure(filepath.Join(p.pressurePath, "io"), totals),
+	}
+	if stats.CPU == nil && stats.Memory == nil && stats.IO == nil {
+		return nil
+	}
+
+	if root := findCgroup2Root(p.cgroupPath); root != "" {
+		stats.Cgroups = p.collectCgroups(root, totals)
+	}
+
+	p.prevTotals = totals
+
+	return stats
+}
+
+// collectCgroups reads the pressure files of all cgroups up to psiCgroupDepth.
+func (p *PSICollector) collectCgroups(root string, totals map[string]uint64) []CgroupPSI {
+	var result []CgroupPSI
+
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == root {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		if strings.Count(rel, string(filepath.Separator)) >= psiCgroupDepth {
+			return filepath.SkipDir
+		}
+
+		cg := CgroupPSI{
+			Cgroup: rel,
+			CPU:    p.readPressure(filepath.Join(path, "cpu.pressure"), totals),
+			Memory: p.readPressure(filepath.Join(path, "memory.pressure"), totals),
+			IO:     p.readPressure(filepath.Join(path, "io.pressure"), totals),
+		}
+		if cg.CPU != nil || cg.Memory != nil || cg.IO != nil {
+			result = append(result, cg)
+		}
+		return nil
+	})
+
+	return result
+}
+
+// readPressure parses a pressure file and computes the stall deltas.
+//
+// Format:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func (p *PSICollector) readPressure(path string, totals map[string]uint64) *PSIResource {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var res *PSIResource
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		var v PSIValues
+		for _, kv := range fields[1:] {
+			key, value, ok := strings.Cut(kv, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "avg10":
+				v.Avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				v.Avg60, _ = strconv.ParseFloat(value, 64)
+			case "avg300":
+				v.Avg300, _ = strconv.ParseFloat(value, 64)
+			case "total":
+				v.TotalUsec, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+
+		key := path + ":" + fields[0]
+		if prev, ok := p.prevTotals[key]; ok {
+			v.StallUsec = sub(v.TotalUsec, prev)
+		}
+		totals[key] = v.TotalUsec
+
+		if res == nil {
+			res = &PSIResource{}
+		}
+		switch fields[0] {
+		case "some":
+			res.Some = v
+		case "full":
+			full := v
+			res.Full = &full
+		}
+	}
+
+	return res
+}
+
+// findCgroup2Root returns the mount point of the cgroup v2 hierarchy below
+// base: base itself on unified systems, base/unified on hybrid systems,
+// or "" if cgroup v2 is not mounted.
+func findCgroup2Root(base string) string {
+	if fileExists(filepath.Join(base, "cgroup.controllers")) {
+		return base
+	}
+	if unified := filepath.Join(base, "unified"); fileExists(filepath.Join(unified, "cgroup.controllers")) {
+		return unified
+	}
+	return ""
+}
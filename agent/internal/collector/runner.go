@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// commandTimeout limits how long an external command may run.
+const commandTimeout = 30 * time.Second
+
+// CommandRunner runs an external command and returns its standard output.
+// Collectors that shell out take one so tests can replace the real tools.
+type CommandRunner func(name string, args ...string) ([]byte, error)
+
+// runCommand is the default CommandRunner.
+func runCommand(name string, args ...string) ([]byte, error) {
+	return runCommandTimeout(commandTimeout, name, args...)
+}
+
+// commandRunner returns a CommandRunner with a different timeout, for
+// commands that run with every push.
+func commandRunner(timeout time.Duration) CommandRunner {
+	return func(name string, args ...string) ([]byte, error) {
+		return runCommandTimeout(timeout, name, args...)
+	}
+}
+
+// runCommandTimeout runs a command and kills it after timeout.
+func runCommandTimeout(timeout time.Duration, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return exec.CommandContext(ctx, name, args...).Output()
+}
@@ -0,0 +1,329 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// EventSMARTDegraded is raised when a disk's health fails or one of its
+// error counters grows between two SMART runs.
+const EventSMARTDegraded = "smart_degraded"
+
+// smartDisk matches the kernel names of disks that may support SMART.
+var smartDisk = regexp.MustCompile(`^(sd[a-z]+|hd[a-z]+|nvme\d+n\d+)$`)
+
+// SMARTStats holds the SMART health of a single disk. Fields that do not
+// apply to the disk type are zero: the sector counters are ATA only,
+// PercentageUsed and MediaErrors NVMe only.
+type SMARTStats struct {
+	Device               string  `json:"device"`
+	Model                string  `json:"model"`
+	Serial               string  `json:"serial"`
+	Protocol             string  `json:"protocol"` // ATA, NVMe or SCSI
+	CapacityBytes        int64   `json:"capacity_bytes"`
+	Health               string  `json:"health"` // PASSED, FAILED or UNKNOWN
+	TemperatureC         float64 `json:"temperature_c"`
+	PowerOnHours         int64   `json:"power_on_hours"`
+	ReallocatedSectors   int64   `json:"reallocated_sectors"`
+	PendingSectors       int64   `json:"pending_sectors"`
+	OfflineUncorrectable int64   `json:"offline_uncorrectable"`
+	GrownDefects         int64   `json:"grown_defects,omitempty"` // SCSI
+	PercentageUsed       int64   `json:"percentage_used,omitempty"`
+	AvailableSpare       int64   `json:"available_spare,omitempty"`
+	MediaErrors          int64   `json:"media_errors,omitempty"`
+	Standby              bool    `json:"standby,omitempty"` // values are from the last run the disk was awake
+	CheckedAt            int64   `json:"checked_at"`
+}
+
+// smartctlOutput is the `smartctl --json -a` output, reduced to the fields
+// we use.
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String string `json:"string"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	Device struct {
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	UserCapacity struct {
+		Bytes int64 `json:"bytes"`
+	} `json:"user_capacity"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current float64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		PercentageUsed int64 `json:"percentage_used"`
+		AvailableSpare int64 `json:"available_spare"`
+		MediaErrors    int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	SCSIGrownDefectList int64 `json:"scsi_grown_defect_list"`
+}
+
+// ATA attribute IDs
+const (
+	ataReallocatedSectors   = 5
+	ataPendingSectors       = 197
+	ataOfflineUncorrectable = 198
+)
+
+// smartctl exit status bits, see smartctl(8)
+const (
+	smartctlCmdLineError = 1 << 0
+	smartctlOpenFailed   = 1 << 1 // also set when the disk is in standby
+)
+
+// SMARTCollector runs smartctl for all local disks. smartctl takes up to
+// seconds per disk, so the disks are read in the background and Collect
+// returns the result of the last completed run.
+type SMARTCollector struct {
+	mu           sync.Mutex
+	run          CommandRunner
+	sysBlockPath string
+	exclude      []string
+	interval     time.Duration
+	last         time.Time
+	refreshing   bool
+	cached       []SMARTStats
+	events       []Event
+	prev         map[string]SMARTStats // only used by refresh
+}
+
+// NewSMARTCollector creates a SMART collector.
+func NewSMARTCollector(cfg config.SMARTConfig) *SMARTCollector {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = config.DefaultSMARTInterval
+	}
+
+	return &SMARTCollector{
+		run:          runCommand,
+		sysBlockPath: "/sys/block",
+		exclude:      cfg.ExcludeDevices,
+		interval:     time.Duration(interval) * time.Second,
+		prev:         make(map[string]SMARTStats),
+	}
+}
+
+// Collect returns the SMART data of all disks and a smart_degraded event
+// for every disk that got worse since the previous run. A refresh is
+// started in the background at most every configured interval, so the
+// first call returns nil. It also returns nil if smartctl is not installed
+// or no disk supports SMART.
+func (s *SMARTCollector) Collect() ([]SMARTStats, []Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.refreshing && time.Since(s.last) >= s.interval {
+		s.last = time.Now()
+		s.refreshing = true
+		go s.refresh()
+	}
+
+	events := s.events
+	s.events = nil
+	return s.cached, events
+}
+
+// refresh runs smartctl for all disks and stores the result and the events
+// for the next Collect.
+func (s *SMARTCollector) refresh() {
+	var result []SMARTStats
+	var events []Event
+
+	for _, dev := range s.listDisks() {
+		cur, ok := s.readDisk(dev)
+		if !ok {
+			continue
+		}
+
+		prev, seen := s.prev[dev]
+		if cur.Standby {
+			if !seen {
+				continue
+			}
+			// Keep reporting the last values instead of waking the disk
+			prev.Standby = true
+			result = append(result, prev)
+			continue
+		}
+
+		if seen && prev.Serial == cur.Serial {
+			events = append(events, smartEvents(prev, cur)...)
+		} else if cur.Health == "FAILED" {
+			events = append(events, smartEvent(cur, "health", "PASSED", cur.Health))
+		}
+
+		s.prev[dev] = cur
+		result = append(result, cur)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cached = result
+	s.events = append(s.events, events...)
+	s.refreshing = false
+}
+
+// listDisks returns the SATA, SAS and NVMe disks in /sys/block. Virtual
+// and removable devices are skipped.
+func (s *SMARTCollector) listDisks() []string {
+	entries, err := os.ReadDir(s.sysBlockPath)
+	if err != nil {
+		return nil
+	}
+
+	var disks []string
+	for _, e := range entries {
+		dev := e.Name()
+		if !smartDisk.MatchString(dev) || matchAny(s.exclude, dev) {
+			continue
+		}
+		if !fileExists(filepath.Join(s.sysBlockPath, dev, "device")) {
+			continue
+		}
+		if readString(filepath.Join(s.sysBlockPath, dev, "removable")) == "1" {
+			continue
+		}
+		disks = append(disks, dev)
+	}
+
+	sort.Strings(disks)
+	return disks
+}
+
+// readDisk runs smartctl for one disk. smartctl uses its exit status as a
+// bit mask that is non-zero for failing disks too, so the output is parsed
+// whenever there is some.
+func (s *SMARTCollector) readDisk(dev string) (SMARTStats, bool) {
+	out, _ := s.run("smartctl", "--json", "-a", "-n", "standby", "/dev/"+dev)
+
+	var o smartctlOutput
+	if len(out) == 0 || json.Unmarshal(out, &o) != nil {
+		return SMARTStats{}, false
+	}
+	if o.Smartctl.ExitStatus&smartctlCmdLineError != 0 {
+		return SMARTStats{}, false
+	}
+	if o.Smartctl.ExitStatus&smartctlOpenFailed != 0 {
+		// -n standby exits with 2 before reading anything:
+		// "Device is in STANDBY mode, exit(2)"
+		for _, msg := range o.Smartctl.Messages {
+			if strings.Contains(msg.String, "STANDBY") || strings.Contains(msg.String, "SLEEP") {
+				return SMARTStats{Device: dev, Standby: true}, true
+			}
+		}
+		return SMARTStats{}, false
+	}
+
+	st := SMARTStats{
+		Device:        dev,
+		Model:         o.ModelName,
+		Serial:        o.SerialNumber,
+		Protocol:      o.Device.Protocol,
+		CapacityBytes: o.UserCapacity.Bytes,
+		Health:        "UNKNOWN",
+		TemperatureC:  o.Temperature.Current,
+		PowerOnHours:  o.PowerOnTime.Hours,
+		GrownDefects:  o.SCSIGrownDefectList,
+		CheckedAt:     time.Now().Unix(),
+	}
+
+	if o.SmartStatus != nil {
+		st.Health = "FAILED"
+		if o.SmartStatus.Passed {
+			st.Health = "PASSED"
+		}
+	}
+
+	for _, attr := range o.ATASmartAttributes.Table {
+		switch attr.ID {
+		case ataReallocatedSectors:
+			st.ReallocatedSectors = attr.Raw.Value
+		case ataPendingSectors:
+			st.PendingSectors = attr.Raw.Value
+		case ataOfflineUncorrectable:
+			st.OfflineUncorrectable = attr.Raw.Value
+		}
+	}
+
+	if o.NVMeHealth != nil {
+		st.PercentageUsed = o.NVMeHealth.PercentageUsed
+		st.AvailableSpare = o.NVMeHealth.AvailableSpare
+		st.MediaErrors = o.NVMeHealth.MediaErrors
+	}
+
+	return st, true
+}
+
+// smartEvents compares two runs of the same disk. Temperature and power-on
+// hours change all the time and are not compared.
+func smartEvents(prev, cur SMARTStats) []Event {
+	var events []Event
+
+	if cur.Health == "FAILED" && prev.Health != "FAILED" {
+		events = append(events, smartEvent(cur, "health", prev.Health, cur.Health))
+	}
+
+	counters := []struct {
+		name      string
+		prev, cur int64
+	}{
+		{"reallocated_sectors", prev.ReallocatedSectors, cur.ReallocatedSectors},
+		{"pending_sectors", prev.PendingSectors, cur.PendingSectors},
+		{"offline_uncorrectable", prev.OfflineUncorrectable, cur.OfflineUncorrectable},
+		{"grown_defects", prev.GrownDefects, cur.GrownDefects},
+		{"percentage_used", prev.PercentageUsed, cur.PercentageUsed},
+		{"media_errors", prev.MediaErrors, cur.MediaErrors},
+	}
+	for _, c := range counters {
+		if c.cur > c.prev {
+			events = append(events, smartEvent(cur, c.name, c.prev, c.cur))
+		}
+	}
+
+	// Available spare counts down
+	if cur.AvailableSpare < prev.AvailableSpare {
+		events = append(events, smartEvent(cur, "available_spare", prev.AvailableSpare, cur.AvailableSpare))
+	}
+
+	return events
+}
+
+// smartEvent creates a smart_degraded event for one attribute.
+func smartEvent(st SMARTStats, attribute string, previous, current interface{}) Event {
+	return newEvent(EventSMARTDegraded, map[string]interface{}{
+		"device":    st.Device,
+		"model":     st.Model,
+		"serial":    strings.TrimSpace(st.Serial),
+		"attribute": attribute,
+		"previous":  previous,
+		"current":   current,
+	})
+}
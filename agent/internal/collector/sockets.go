@@ -0,0 +1,310 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listeningResend is how often the listening socket inventory is sent even
+// if it did not change, so a restarted server gets it again.
+const listeningResend = 10 * time.Minute
+
+// tcpStates maps the hex state of /proc/net/tcp to its name
+// (include/net/tcp_states.h).
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+	"0C": "new_syn_recv",
+}
+
+// SocketStats holds socket counters. TCPStates counts IPv4 and IPv6
+// sockets by state; the other fields are from /proc/net/sockstat.
+type SocketStats struct {
+	TCPStates   map[string]int `json:"tcp_states"`
+	TCPInUse    int            `json:"tcp_inuse"`
+	TCPOrphan   int            `json:"tcp_orphan"`
+	TCPTimeWait int            `json:"tcp_time_wait"`
+	TCPAlloc    int            `json:"tcp_alloc"`
+	TCPMemBytes int64          `json:"tcp_mem_bytes"`
+	UDPInUse    int            `json:"udp_inuse"`
+	UDPMemBytes int64          `json:"udp_mem_bytes"`
+	SocketsUsed int            `json:"sockets_used"`
+}
+
+// ListeningSocket is a TCP socket in LISTEN state or an unconnected UDP
+// socket, with the process owning it.
+type ListeningSocket struct {
+	Proto   string `json:"proto"` // tcp, tcp6, udp or udp6
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+
+	inode string
+}
+
+// SocketCollector reports socket states and the listening sockets.
+type SocketCollector struct {
+	mu          sync.Mutex
+	procPath    string
+	listening   []ListeningSocket // with owners, for resolvedKey
+	resolvedKey string
+	sentKey     string // last inventory the server received
+	lastSent    time.Time
+}
+
+// NewSocketCollector creates a new socket collector.
+func NewSocketCollector() *SocketCollector {
+	return &SocketCollector{procPath: "/proc"}
+}
+
+// Collect returns the socket counters and the listening socket inventory.
+// The inventory is only returned when it changed since it was last passed
+// to Sent, or every listeningResend; otherwise it is nil. No listening
+// sockets are returned as an empty slice.
+func (s *SocketCollector) Collect() (*SocketStats, []ListeningSocket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := &SocketStats{TCPStates: make(map[string]int)}
+	var listening []ListeningSocket
+
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		listening = append(listening, readNetSockets(filepath.Join(s.procPath, "net", proto), proto, stats.TCPStates)...)
+	}
+	s.readSockstat(stats)
+
+	sort.Slice(listening, func(i, j int) bool {
+		a, b := listening[i], listening[j]
+		if a.Proto != b.Proto {
+			return a.Proto < b.Proto
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Address < b.Address
+	})
+
+	// The owners are only looked up again when the sockets changed
+	key := listeningKey(listening)
+	if key != s.resolvedKey {
+		s.resolveOwners(listening)
+		if listening == nil {
+			listening = []ListeningSocket{}
+		}
+		s.listening = listening
+		s.resolvedKey = key
+	}
+
+	if key == s.sentKey && time.Since(s.lastSent) < listeningResend {
+		return stats, nil
+	}
+	return stats, s.listening
+}
+
+// Sent records that the server received a listening socket inventory
+// returned by Collect, so it is not returned again until it changes.
+func (s *SocketCollector) Sent(listening []ListeningSocket) {
+	if listening == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sentKey = listeningKey(listening)
+	s.lastSent = time.Now()
+}
+
+// listeningKey identifies a listening socket inventory. Sockets are
+// recreated on service restarts, so the inode is part of the key.
+func listeningKey(listening []ListeningSocket) string {
+	var key strings.Builder
+	for _, l := range listening {
+		key.WriteString(l.Proto + " " + l.Address + " " + strconv.Itoa(l.Port) + " " + l.inode + "\n")
+	}
+	return key.String()
+}
+
+// readNetSockets parses a /proc/net/{tcp,tcp6,udp,udp6} table. TCP states
+// are counted into states; listening sockets are returned.
+//
+//	sl  local_address rem_address   st tx_queue:rx_queue tr:tm->when retrnsmt   uid  timeout inode
+//	 0: 0100007F:0277 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21436 ...
+func readNetSockets(path, proto string, states map[string]int) []ListeningSocket {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	isTCP := strings.HasPrefix(proto, "tcp")
+
+	var listening []ListeningSocket
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		state := fields[3]
+		if isTCP {
+			if name, ok := tcpStates[state]; ok {
+				states[name]++
+			}
+			if state != "0A" {
+				continue
+			}
+		} else if !strings.HasSuffix(fields[2], ":0000") {
+			// Connected UDP sockets have a remote port
+			continue
+		}
+
+		addr, port, ok := parseSocketAddr(fields[1])
+		if !ok {
+			continue
+		}
+		listening = append(listening, ListeningSocket{
+			Proto:   proto,
+			Address: addr,
+			Port:    port,
+			inode:   fields[9],
+		})
+	}
+
+	return listening
+}
+
+// parseSocketAddr decodes "0100007F:0277" into 127.0.0.1 and 631. The
+// address is stored as 32-bit words in host byte order.
+func parseSocketAddr(s string) (string, int, bool) {
+	hexAddr, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, false
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+
+	port, err := strconv.ParseInt(hexPort, 16, 32)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return ip.String(), int(port), true
+}
+
+// readSockstat reads the IPv4 counters of /proc/net/sockstat:
+//
+//	sockets: used 290
+//	TCP: inuse 8 orphan 0 tw 2 alloc 12 mem 1
+//	UDP: inuse 4 mem 2
+func (s *SocketCollector) readSockstat(stats *SocketStats) {
+	data, err := os.ReadFile(filepath.Join(s.procPath, "net", "sockstat"))
+	if err != nil {
+		return
+	}
+
+	pageSize := int64(os.Getpagesize())
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		values := make(map[string]int64)
+		for i := 1; i+1 < len(fields); i += 2 {
+			values[fields[i]], _ = strconv.ParseInt(fields[i+1], 10, 64)
+		}
+
+		switch fields[0] {
+		case "sockets:":
+			stats.SocketsUsed = int(values["used"])
+		case "TCP:":
+			stats.TCPInUse = int(values["inuse"])
+			stats.TCPOrphan = int(values["orphan"])
+			stats.TCPTimeWait = int(values["tw"])
+			stats.TCPAlloc = int(values["alloc"])
+			stats.TCPMemBytes = values["mem"] * pageSize
+		case "UDP:":
+			stats.UDPInUse = int(values["inuse"])
+			stats.UDPMemBytes = values["mem"] * pageSize
+		}
+	}
+}
+
+// resolveOwners finds the process of each listening socket by matching
+// the socket inodes against the "socket:[inode]" links in /proc/[pid]/fd.
+func (s *SocketCollector) resolveOwners(listening []ListeningSocket) {
+	wanted := make(map[string]bool, len(listening))
+	for _, l := range listening {
+		wanted[l.inode] = true
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	owners := make(map[string]int, len(wanted))
+
+	entries, _ := os.ReadDir(s.procPath)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join(s.procPath, e.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, seen := owners[inode]; wanted[inode] && !seen {
+				owners[inode] = pid
+			}
+		}
+
+		if len(owners) == len(wanted) {
+			break
+		}
+	}
+
+	for i := range listening {
+		if pid, ok := owners[listening[i].inode]; ok {
+			listening[i].PID = pid
+			listening[i].Process = readString(filepath.Join(s.procPath, strconv.Itoa(pid), "comm"))
+		}
+	}
+}
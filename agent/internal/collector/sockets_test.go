@@ -0,0 +1,41 @@
+package collector
+
+import "testing"
+
+const tcpHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func TestSocketListeningChanges(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, "net/tcp", tcpHeader+
+		"   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0\n"+
+		"   1: 0100007F:0016 0100007F:A000 01 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1\n")
+	s := &SocketCollector{procPath: root}
+
+	stats, listening := s.Collect()
+	if stats.TCPStates["listen"] != 1 || stats.TCPStates["established"] != 1 {
+		t.Errorf("TCPStates = %v", stats.TCPStates)
+	}
+	if len(listening) != 1 || listening[0].Proto != "tcp" || listening[0].Port != 22 || listening[0].Address != "0.0.0.0" {
+		t.Fatalf("listening = %+v", listening)
+	}
+
+	// Returned until the server received it, e.g. after a failed push
+	if _, again := s.Collect(); len(again) != 1 {
+		t.Errorf("unsent inventory not returned again: %+v", again)
+	}
+	s.Sent(listening)
+	if _, unchanged := s.Collect(); unchanged != nil {
+		t.Errorf("unchanged inventory returned: %+v", unchanged)
+	}
+
+	// No listening sockets anymore is a change, sent as an empty list
+	writeFixture(t, root, "net/tcp", tcpHeader)
+	_, listening = s.Collect()
+	if listening == nil || len(listening) != 0 {
+		t.Fatalf("listening = %#v, want empty slice", listening)
+	}
+	s.Sent(listening)
+	if _, unchanged := s.Collect(); unchanged != nil {
+		t.Errorf("unchanged inventory returned: %+v", unchanged)
+	}
+}
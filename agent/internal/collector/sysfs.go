@@ -0,0 +1,32 @@
+package collector
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readString reads a single-value sysfs/procfs file and returns its
+// trimmed content, or "" if it cannot be read.
+func readString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readInt reads a single integer value from a sysfs/procfs file.
+func readInt(path string) (int64, bool) {
+	v, err := strconv.ParseInt(readString(path), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// fileExists reports whether the path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,211 @@
+package collector
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// systemdInterval is how often systemctl is queried. Unit states rarely
+// change, so forking systemctl on every push would be wasteful.
+const systemdInterval = 30 * time.Second
+
+// UnitStatus describes a single systemd unit.
+type UnitStatus struct {
+	Unit            string `json:"unit"`
+	Description     string `json:"description,omitempty"`
+	LoadState       string `json:"load_state"`
+	ActiveState     string `json:"active_state"`
+	SubState        string `json:"sub_state"`
+	Result          string `json:"result,omitempty"`
+	StateChangeTime string `json:"state_change_time,omitempty"`
+	Restarts        int    `json:"restarts"`
+}
+
+// SystemdStats holds unit counts, failed units and watch-listed units.
+type SystemdStats struct {
+	Total        int          `json:"total"`
+	Active       int          `json:"active"`
+	Inactive     int          `json:"inactive"`
+	Failed       int          `json:"failed"`
+	Activating   int          `json:"activating"`
+	Deactivating int          `json:"deactivating"`
+	FailedUnits  []UnitStatus `json:"failed_units"`
+	Watched      []UnitStatus `json:"watched,omitempty"`
+}
+
+// systemctlUnit is one entry of `systemctl list-units --output=json`.
+type systemctlUnit struct {
+	Unit        string `json:"unit"`
+	Load        string `json:"load"`
+	Active      string `json:"active"`
+	Sub         string `json:"sub"`
+	Description string `json:"description"`
+}
+
+// SystemdCollector reports systemd unit health via systemctl. systemctl
+// blocks while PID 1 is busy, so it runs in the background and Collect
+// returns the result of the last completed run.
+type SystemdCollector struct {
+	mu         sync.Mutex
+	run        CommandRunner
+	watch      []string
+	last       time.Time
+	refreshing bool
+	cached     *SystemdStats
+	interval   time.Duration
+}
+
+// NewSystemdCollector creates a systemd collector.
+func NewSystemdCollector(cfg config.SystemdConfig) *SystemdCollector {
+	watch := make([]string, 0, len(cfg.WatchUnits))
+	for _, u := range cfg.WatchUnits {
+		if !strings.Contains(u, ".") {
+			u += ".service"
+		}
+		watch = append(watch, u)
+	}
+
+	return &SystemdCollector{
+		run:      runCommand,
+		watch:    watch,
+		interval: systemdInterval,
+	}
+}
+
+// Collect returns the unit health. A refresh is started in the background
+// at most every systemdInterval, so the first call returns nil. It also
+// returns nil on hosts without systemd.
+func (s *SystemdCollector) Collect() *SystemdStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.refreshing && time.Since(s.last) >= s.interval {
+		s.last = time.Now()
+		s.refreshing = true
+		go s.refresh()
+	}
+
+	return s.cached
+}
+
+// refresh queries systemctl and stores the result for the next Collect.
+func (s *SystemdCollector) refresh() {
+	stats := s.read()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cached = stats
+	s.refreshing = false
+}
+
+// read returns the unit health, or nil if systemctl fails.
+func (s *SystemdCollector) read() *SystemdStats {
+	units, err := s.listUnits()
+	if err != nil {
+		return nil
+	}
+
+	stats := &SystemdStats{FailedUnits: []UnitStatus{}}
+	for _, u := range units {
+		// Units that are referenced but not installed
+		if u.Load == "not-found" {
+			continue
+		}
+
+		stats.Total++
+		switch u.Active {
+		case "active", "reloading":
+			stats.Active++
+		case "inactive":
+			stats.Inactive++
+		case "failed":
+			stats.Failed++
+			stats.FailedUnits = append(stats.FailedUnits, s.unitStatus(u.Unit, u.Description))
+		case "activating":
+			stats.Activating++
+		case "deactivating":
+			stats.Deactivating++
+		}
+	}
+
+	for _, unit := range s.watch {
+		stats.Watched = append(stats.Watched, s.unitStatus(unit, ""))
+	}
+
+	return stats
+}
+
+// listUnits returns all loaded units. It uses the JSON output where
+// available and falls back to the plain table on systemd < 246.
+func (s *SystemdCollector) listUnits() ([]systemctlUnit, error) {
+	out, err := s.run("systemctl", "list-units", "--all", "--output=json", "--no-pager")
+	if err == nil {
+		var units []systemctlUnit
+		if json.Unmarshal(out, &units) == nil {
+			return units, nil
+		}
+	}
+
+	out, err = s.run("systemctl", "list-units", "--all", "--plain", "--no-legend", "--no-pager")
+	if err != nil {
+		return nil, err
+	}
+
+	var units []systemctlUnit
+	for _, line := range strings.Split(string(out), "\n") {
+		// Format: UNIT LOAD ACTIVE SUB DESCRIPTION...
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		units = append(units, systemctlUnit{
+			Unit:        fields[0],
+			Load:        fields[1],
+			Active:      fields[2],
+			Sub:         fields[3],
+			Description: strings.Join(fields[4:], " "),
+		})
+	}
+
+	return units, nil
+}
+
+// unitStatus queries the details of a single unit with `systemctl show`.
+func (s *SystemdCollector) unitStatus(unit, description string) UnitStatus {
+	status := UnitStatus{Unit: unit, Description: description}
+
+	out, err := s.run("systemctl", "show", unit, "--no-pager",
+		"--property=LoadState,ActiveState,SubState,Result,StateChangeTimestamp,NRestarts")
+	if err != nil {
+		return status
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "LoadState":
+			status.LoadState = value
+		case "ActiveState":
+			status.ActiveState = value
+		case "SubState":
+			status.SubState = value
+		case "Result":
+			status.Result = value
+		case "StateChangeTimestamp":
+			status.StateChangeTime = value
+		case "NRestarts":
+			status.Restarts, _ = strconv.Atoi(value)
+		}
+	}
+
+	return status
+}
@@ -3,47 +3,253 @@ package collector
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-// CollectTemperature reads CPU temperature from thermal zones.
-// Returns the temperature in Celsius and true if successful.
-func CollectTemperature() (float64, bool) {
-	// Try common thermal zone paths
-	paths := []string{
-		"/sys/class/thermal/thermal_zone0/temp",
-		"/sys/class/hwmon/hwmon0/temp1_input",
-		"/sys/devices/virtual/thermal/thermal_zone0/temp",
+// Sensor types reported in SensorReading.Type.
+const (
+	SensorTemp    = "temp"
+	SensorFan     = "fan"
+	SensorVoltage = "voltage"
+	SensorPower   = "power"
+)
+
+// SensorReading is a single hwmon or thermal zone reading.
+// Value is in °C, RPM, V or W depending on Type.
+type SensorReading struct {
+	Chip   string   `json:"chip"`   // hwmon name or thermal zone type
+	Source string   `json:"source"` // e.g. "hwmon2" or "thermal_zone0"
+	Label  string   `json:"label"`
+	Type   string   `json:"type"`
+	Value  float64  `json:"value"`
+	Max    *float64 `json:"max,omitempty"`
+	Crit   *float64 `json:"crit,omitempty"`
+}
+
+// cpuTempPriority lists the sensors used for temp_cpu, best first.
+// Entries are "chip/label" or just "chip" to match any label of the chip.
+//
+//   - coretemp "Package id 0": Intel package temperature
+//   - k10temp "Tctl"/"Tdie", zenpower "Tdie": AMD
+//   - cpu_thermal: Raspberry Pi and most ARM SoCs
+//   - soc_thermal, x86_pkg_temp: other SoCs / Intel thermal zone
+//   - acpitz: ACPI thermal zone, often only a board temperature
+var cpuTempPriority = []string{
+	"coretemp/Package id 0",
+	"k10temp/Tctl",
+	"k10temp/Tdie",
+	"zenpower/Tdie",
+	"cpu_thermal",
+	"cpu-thermal",
+	"soc_thermal",
+	"x86_pkg_temp",
+	"coretemp",
+	"k10temp",
+	"acpitz",
+}
+
+// SensorCollector enumerates hwmon chips and thermal zones.
+type SensorCollector struct {
+	hwmonPath   string
+	thermalPath string
+	cpuSensor   string
+}
+
+// NewSensorCollector creates a sensor collector. cpuSensor overrides the
+// sensor used for temp_cpu ("chip/label" or "chip"); empty uses the
+// built-in priority list.
+func NewSensorCollector(cpuSensor string) *SensorCollector {
+	return &SensorCollector{
+		hwmonPath:   "/sys/class/hwmon",
+		thermalPath: "/sys/class/thermal",
+		cpuSensor:   cpuSensor,
 	}
+}
 
-	for _, path := range paths {
-		if temp, ok := readTempFile(path); ok {
-			return temp, true
-		}
+// Collect returns all sensor readings and the CPU temperature picked from
+// them. The CPU temperature is nil if no temperature sensor is available.
+func (s *SensorCollector) Collect() ([]SensorReading, *float64) {
+	var readings []SensorReading
+	readings = append(readings, s.readHwmon()...)
+	readings = append(readings, s.readThermalZones()...)
+
+	return readings, pickCPUTemp(readings, s.cpuSensor)
+}
+
+// pickCPUTemp selects the CPU temperature: the configured sensor if set and
+// present, otherwise the first match of cpuTempPriority, otherwise the first
+// temperature reading at all.
+func pickCPUTemp(readings []SensorReading, override string) *float64 {
+	candidates := cpuTempPriority
+	if override != "" {
+		candidates = append([]string{override}, candidates...)
 	}
 
-	// Try to find any thermal zone
-	matches, err := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
-	if err == nil {
-		for _, path := range matches {
-			if temp, ok := readTempFile(path); ok {
-				return temp, true
+	for _, want := range candidates {
+		chip, label, hasLabel := strings.Cut(want, "/")
+		for _, r := range readings {
+			if r.Type != SensorTemp || r.Chip != chip {
+				continue
+			}
+			if hasLabel && r.Label != label {
+				continue
 			}
+			v := r.Value
+			return &v
 		}
 	}
 
-	// Try hwmon paths
-	matches, err = filepath.Glob("/sys/class/hwmon/hwmon*/temp*_input")
-	if err == nil {
-		for _, path := range matches {
-			if temp, ok := readTempFile(path); ok {
-				return temp, true
+	for _, r := range readings {
+		if r.Type == SensorTemp {
+			v := r.Value
+			return &v
+		}
+	}
+
+	return nil
+}
+
+// readHwmon reads all temperature, fan, voltage and power inputs of all
+// hwmon chips.
+func (s *SensorCollector) readHwmon() []SensorReading {
+	chips, err := filepath.Glob(filepath.Join(s.hwmonPath, "hwmon*"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(chips)
+
+	var readings []SensorReading
+	for _, dir := range chips {
+		// Older drivers keep their attributes in the device directory
+		if !fileExists(filepath.Join(dir, "name")) && fileExists(filepath.Join(dir, "device", "name")) {
+			dir = filepath.Join(dir, "device")
+		}
+
+		chip := readString(filepath.Join(dir, "name"))
+		source := filepath.Base(strings.TrimSuffix(dir, "/device"))
+
+		inputs, _ := filepath.Glob(filepath.Join(dir, "*_input"))
+		// Some power meters only provide an average
+		averages, _ := filepath.Glob(filepath.Join(dir, "power*_average"))
+		for _, avg := range averages {
+			if !fileExists(strings.TrimSuffix(avg, "_average") + "_input") {
+				inputs = append(inputs, avg)
 			}
 		}
+		sort.Strings(inputs)
+
+		for _, input := range inputs {
+			r, ok := readHwmonInput(dir, filepath.Base(input))
+			if !ok {
+				continue
+			}
+			r.Chip = chip
+			r.Source = source
+			readings = append(readings, r)
+		}
 	}
 
-	return 0, false
+	return readings
+}
+
+// readHwmonInput reads one hwmon input file such as temp1_input or fan2_input
+// together with its label, max and crit attributes.
+func readHwmonInput(dir, file string) (SensorReading, bool) {
+	// "temp1_input" -> prefix "temp1", kind "temp"
+	prefix := file[:strings.LastIndex(file, "_")]
+	kind := strings.TrimRight(prefix, "0123456789")
+
+	var sensorType string
+	var scale float64
+	switch kind {
+	case "temp":
+		sensorType, scale = SensorTemp, 1000 // millidegrees
+	case "fan":
+		sensorType, scale = SensorFan, 1 // RPM
+	case "in":
+		sensorType, scale = SensorVoltage, 1000 // millivolts
+	case "power":
+		sensorType, scale = SensorPower, 1000000 // microwatts
+	default:
+		return SensorReading{}, false
+	}
+
+	raw, ok := readInt(filepath.Join(dir, file))
+	if !ok {
+		return SensorReading{}, false
+	}
+
+	r := SensorReading{
+		Label: readString(filepath.Join(dir, prefix+"_label")),
+		Type:  sensorType,
+		Value: float64(raw) / scale,
+	}
+	if r.Label == "" {
+		r.Label = prefix
+	}
+
+	if sensorType == SensorTemp {
+		// Sanity check - disconnected sensors report nonsense like -127°C
+		if r.Value < -50 || r.Value > 150 {
+			return SensorReading{}, false
+		}
+		if v, ok := readInt(filepath.Join(dir, prefix+"_max")); ok {
+			maxTemp := float64(v) / scale
+			r.Max = &maxTemp
+		}
+		if v, ok := readInt(filepath.Join(dir, prefix+"_crit")); ok {
+			critTemp := float64(v) / scale
+			r.Crit = &critTemp
+		}
+	}
+
+	return r, true
+}
+
+// readThermalZones reads all thermal zones.
+func (s *SensorCollector) readThermalZones() []SensorReading {
+	zones, err := filepath.Glob(filepath.Join(s.thermalPath, "thermal_zone*"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(zones)
+
+	var readings []SensorReading
+	for _, dir := range zones {
+		temp, ok := readTempFile(filepath.Join(dir, "temp"))
+		if !ok {
+			continue
+		}
+
+		zoneType := readString(filepath.Join(dir, "type"))
+		readings = append(readings, SensorReading{
+			Chip:   zoneType,
+			Source: filepath.Base(dir),
+			Label:  zoneType,
+			Type:   SensorTemp,
+			Value:  temp,
+			Crit:   thermalZoneCrit(dir),
+		})
+	}
+
+	return readings
+}
+
+// thermalZoneCrit returns the temperature of the zone's "critical" trip
+// point, if it has one.
+func thermalZoneCrit(dir string) *float64 {
+	types, _ := filepath.Glob(filepath.Join(dir, "trip_point_*_type"))
+	for _, t := range types {
+		if readString(t) != "critical" {
+			continue
+		}
+		if temp, ok := readTempFile(strings.TrimSuffix(t, "_type") + "_temp"); ok {
+			return &temp
+		}
+	}
+	return nil
 }
 
 // readTempFile reads a temperature file and returns the value in Celsius.
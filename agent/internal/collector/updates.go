@@ -0,0 +1,357 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// maxUpdatePackages limits the package list sent with every push. The
+// counts always cover all packages.
+const maxUpdatePackages = 50
+
+// dnfUpdatesAvailable is the exit status of `dnf check-update` when
+// updates are available.
+const dnfUpdatesAvailable = 100
+
+var (
+	// Inst openssl [3.0.11-1~deb12u1] (3.0.11-1~deb12u2 Debian-Security:12/stable-security [amd64])
+	aptInst = regexp.MustCompile(`^Inst (\S+) (?:\[(\S+)\] )?\((\S+) ([^\[]*?)\s*(?:\[\S+\])?\)`)
+	// busybox-1.36.1-r2 < 1.36.1-r5
+	apkVersion = regexp.MustCompile(`^(.+)-([^-]+-r\d+)\s+<\s+(\S+)`)
+)
+
+// PackageUpdate is a single pending package update.
+type PackageUpdate struct {
+	Name       string `json:"name"`
+	OldVersion string `json:"old_version,omitempty"`
+	NewVersion string `json:"new_version"`
+	Security   bool   `json:"is_security"`
+}
+
+// UpdateStats holds the pending package updates and reboot state.
+type UpdateStats struct {
+	Manager        string          `json:"manager"` // apt, dnf, yum, apk or pacman; empty if not checked
+	Total          int             `json:"total"`
+	Security       int             `json:"security"`
+	Packages       []PackageUpdate `json:"packages"` // at most maxUpdatePackages
+	CheckedAt      int64           `json:"checked_at"`
+	RebootRequired bool            `json:"reboot_required"`
+	RebootReasons  []string        `json:"reboot_reasons,omitempty"`
+	RunningKernel  string          `json:"running_kernel"`
+	NewestKernel   string          `json:"newest_kernel,omitempty"`
+}
+
+// UpdatesCollector checks for pending package updates with the system's
+// package manager. The package managers can take many seconds, so they run
+// in the background and Collect returns the result of the last check.
+type UpdatesCollector struct {
+	mu          sync.Mutex
+	run         CommandRunner
+	lookPath    func(file string) (string, error)
+	procPath    string
+	runPath     string
+	modulesPath string
+	interval    time.Duration
+	last        time.Time
+	checking    bool
+	cached      *UpdateStats
+}
+
+// NewUpdatesCollector creates a package update collector.
+func NewUpdatesCollector(cfg config.UpdatesConfig) *UpdatesCollector {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = config.DefaultUpdatesInterval
+	}
+
+	return &UpdatesCollector{
+		run:         runCommand,
+		lookPath:    exec.LookPath,
+		procPath:    "/proc",
+		runPath:     "/var/run",
+		modulesPath: "/lib/modules",
+		interval:    time.Duration(interval) * time.Second,
+	}
+}
+
+// Collect returns the pending updates and the reboot-required state, which
+// is checked every call. A check for updates is started in the background
+// at most every configured interval. Until one succeeded, e.g. on the first
+// call, when the package manager fails or when there is no supported one,
+// only the reboot state is set and Manager is empty.
+func (u *UpdatesCollector) Collect() *UpdateStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.checking && time.Since(u.last) >= u.interval {
+		u.last = time.Now()
+		u.checking = true
+		go u.refresh()
+	}
+
+	stats := UpdateStats{Packages: []PackageUpdate{}}
+	if u.cached != nil {
+		stats = *u.cached
+	}
+	u.checkReboot(&stats)
+	return &stats
+}
+
+// refresh checks for updates and stores the result for the next Collect.
+func (u *UpdatesCollector) refresh() {
+	stats := u.checkUpdates()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.cached = stats
+	u.checking = false
+}
+
+// checkUpdates runs the first available package manager.
+func (u *UpdatesCollector) checkUpdates() *UpdateStats {
+	managers := []struct {
+		name, binary string
+		check        func() ([]PackageUpdate, error)
+	}{
+		{"apt", "apt-get", u.checkApt},
+		{"dnf", "dnf", func() ([]PackageUpdate, error) { return u.checkDnf("dnf") }},
+		{"yum", "yum", func() ([]PackageUpdate, error) { return u.checkDnf("yum") }},
+		{"apk", "apk", u.checkApk},
+		{"pacman", "pacman", u.checkPacman},
+	}
+
+	for _, m := range managers {
+		if _, err := u.lookPath(m.binary); err != nil {
+			continue
+		}
+
+		packages, err := m.check()
+		if err != nil {
+			return nil
+		}
+
+		stats := &UpdateStats{
+			Manager:   m.name,
+			Total:     len(packages),
+			Packages:  []PackageUpdate{},
+			CheckedAt: time.Now().Unix(),
+		}
+		for _, p := range packages {
+			if p.Security {
+				stats.Security++
+			}
+		}
+		if len(packages) > maxUpdatePackages {
+			packages = packages[:maxUpdatePackages]
+		}
+		stats.Packages = append(stats.Packages, packages...)
+		return stats
+	}
+
+	return nil
+}
+
+// checkApt simulates an upgrade against the current package lists.
+func (u *UpdatesCollector) checkApt() ([]PackageUpdate, error) {
+	out, err := u.run("apt-get", "-s", "-q", "upgrade")
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []PackageUpdate
+	for _, line := range strings.Split(string(out), "\n") {
+		m := aptInst.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		packages = append(packages, PackageUpdate{
+			Name:       m[1],
+			OldVersion: m[2],
+			NewVersion: m[3],
+			Security:   strings.Contains(strings.ToLower(m[4]), "security"),
+		})
+	}
+
+	return packages, nil
+}
+
+// checkDnf lists updates from the metadata cache and marks those with a
+// security advisory. dnf and yum share the output format.
+func (u *UpdatesCollector) checkDnf(binary string) ([]PackageUpdate, error) {
+	out, err := u.run(binary, "check-update", "-q", "-C")
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == dnfUpdatesAvailable) {
+		return nil, err
+	}
+
+	// Advisory lines: "FEDORA-2024-1a2b3c4d5e Important/Sec. openssl-1:3.1.4-3.fc40.x86_64",
+	// keyed by "name.arch" like the check-update output
+	security := make(map[string]bool)
+	if adv, err := u.run(binary, "updateinfo", "list", "--security", "-q", "-C"); err == nil {
+		for _, line := range strings.Split(string(adv), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 3 {
+				security[nevraNameArch(fields[2])] = true
+			}
+		}
+	}
+
+	var packages []PackageUpdate
+	for _, line := range strings.Split(string(out), "\n") {
+		// "Obsoleting Packages" is followed by a second, indented list
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+
+		// name.arch  version  repository
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		name := fields[0]
+		if i := strings.LastIndex(name, "."); i > 0 {
+			name = name[:i]
+		}
+
+		packages = append(packages, PackageUpdate{
+			Name:       name,
+			NewVersion: fields[1],
+			Security:   security[fields[0]],
+		})
+	}
+
+	return packages, nil
+}
+
+// nevraNameArch turns "openssl-libs-1:3.1.4-3.fc40.x86_64" into
+// "openssl-libs.x86_64".
+func nevraNameArch(nevra string) string {
+	i := strings.LastIndex(nevra, ".")
+	if i < 0 {
+		return nevra
+	}
+	name, arch := nevra[:i], nevra[i:]
+	for n := 0; n < 2; n++ {
+		if j := strings.LastIndex(name, "-"); j > 0 {
+			name = name[:j]
+		}
+	}
+	return name + arch
+}
+
+// checkApk compares the installed packages against the repository index.
+func (u *UpdatesCollector) checkApk() ([]PackageUpdate, error) {
+	out, err := u.run("apk", "version", "-l", "<")
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []PackageUpdate
+	for _, line := range strings.Split(string(out), "\n") {
+		if m := apkVersion.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			packages = append(packages, PackageUpdate{Name: m[1], OldVersion: m[2], NewVersion: m[3]})
+		}
+	}
+
+	return packages, nil
+}
+
+// checkPacman uses checkupdates (pacman-contrib), which syncs a temporary
+// database copy, and falls back to `pacman -Qu` against the synced
+// database. Arch has no security metadata in the package database.
+func (u *UpdatesCollector) checkPacman() ([]PackageUpdate, error) {
+	out, err := u.run("checkupdates")
+	if err != nil {
+		// checkupdates exits with 2 if there are no updates
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+			return nil, nil
+		}
+		// pacman -Qu exits with 1 if there are no updates
+		if out, err = u.run("pacman", "-Qu"); err != nil && !errors.As(err, &exitErr) {
+			return nil, err
+		}
+	}
+
+	var packages []PackageUpdate
+	for _, line := range strings.Split(string(out), "\n") {
+		// name old -> new
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[2] == "->" {
+			packages = append(packages, PackageUpdate{Name: fields[0], OldVersion: fields[1], NewVersion: fields[3]})
+		}
+	}
+
+	return packages, nil
+}
+
+// checkReboot sets the reboot state from the Debian reboot-required flag
+// file and from a running kernel older than the newest installed one.
+func (u *UpdatesCollector) checkReboot(stats *UpdateStats) {
+	stats.RebootRequired = false
+	stats.RebootReasons = nil
+
+	if fileExists(filepath.Join(u.runPath, "reboot-required")) {
+		stats.RebootRequired = true
+		stats.RebootReasons = append(stats.RebootReasons, "reboot-required")
+	}
+
+	stats.RunningKernel = readString(filepath.Join(u.procPath, "sys", "kernel", "osrelease"))
+	stats.NewestKernel = ""
+
+	entries, err := os.ReadDir(u.modulesPath)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() && compareKernelVersions(e.Name(), stats.NewestKernel) > 0 {
+			stats.NewestKernel = e.Name()
+		}
+	}
+
+	if stats.RunningKernel != "" && compareKernelVersions(stats.NewestKernel, stats.RunningKernel) > 0 {
+		stats.RebootRequired = true
+		stats.RebootReasons = append(stats.RebootReasons, "kernel")
+	}
+}
+
+// compareKernelVersions compares the leading numeric components of two
+// kernel releases: "6.1.0-21-amd64" is [6 1 0 21], "6.6.31+rpt-rpi-v8" is
+// [6 6 31]. Flavours of the same version compare equal.
+func compareKernelVersions(a, b string) int {
+	va, vb := kernelVersion(a), kernelVersion(b)
+	for i := 0; i < len(va) && i < len(vb); i++ {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(va) - len(vb)
+}
+
+// kernelVersion splits a kernel release into its leading numbers.
+func kernelVersion(release string) []int {
+	var version []int
+	for _, part := range strings.FieldsFunc(release, func(r rune) bool {
+		return r == '.' || r == '-' || r == '+' || r == '_'
+	}) {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		version = append(version, n)
+	}
+	return version
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeUpdatesCollector returns a collector for a host running kernel 6.1.0
+// with 6.1.0 and 6.6.0 installed and /run/reboot-required present. The
+// background check is not started; tests call refresh themselves.
+func fakeUpdatesCollector(t *testing.T, lookPath func(string) (string, error), run CommandRunner) *UpdatesCollector {
+	t.Helper()
+
+	root := t.TempDir()
+	writeFixture(t, root, "proc/sys/kernel/osrelease", "6.1.0-21-amd64\n")
+	writeFixture(t, root, "run/reboot-required", "*** System restart required ***\n")
+	writeFixture(t, root, "lib/modules/6.1.0-21-amd64/modules.dep", "")
+	writeFixture(t, root, "lib/modules/6.6.0-1-amd64/modules.dep", "")
+
+	return &UpdatesCollector{
+		run:         run,
+		lookPath:    lookPath,
+		procPath:    filepath.Join(root, "proc"),
+		runPath:     filepath.Join(root, "run"),
+		modulesPath: filepath.Join(root, "lib/modules"),
+		interval:    time.Hour,
+		last:        time.Now(),
+	}
+}
+
+// checkRebootState checks the reboot state of fakeUpdatesCollector.
+func checkRebootState(t *testing.T, stats *UpdateStats) {
+	t.Helper()
+
+	if stats == nil {
+		t.Fatal("Collect returned nil")
+	}
+	if !stats.RebootRequired || len(stats.RebootReasons) != 2 {
+		t.Errorf("reboot = %v %v, want required for reboot-required and kernel", stats.RebootRequired, stats.RebootReasons)
+	}
+	if stats.RunningKernel != "6.1.0-21-amd64" || stats.NewestKernel != "6.6.0-1-amd64" {
+		t.Errorf("kernels = %q/%q", stats.RunningKernel, stats.NewestKernel)
+	}
+}
+
+func TestUpdatesNoPackageManager(t *testing.T) {
+	u := fakeUpdatesCollector(t,
+		func(file string) (string, error) { return "", exec.ErrNotFound },
+		func(name string, args ...string) ([]byte, error) {
+			t.Errorf("ran %s without a package manager", name)
+			return nil, nil
+		})
+
+	// Before the first check
+	checkRebootState(t, u.Collect())
+
+	u.refresh()
+	stats := u.Collect()
+	checkRebootState(t, stats)
+	if stats.Manager != "" || stats.Total != 0 || stats.CheckedAt != 0 {
+		t.Errorf("stats = %+v, want no package data", stats)
+	}
+}
+
+func TestUpdatesPackageManagerFails(t *testing.T) {
+	fail := false
+	u := fakeUpdatesCollector(t,
+		func(file string) (string, error) {
+			if file != "apt-get" {
+				return "", exec.ErrNotFound
+			}
+			return "/usr/bin/apt-get", nil
+		},
+		func(name string, args ...string) ([]byte, error) {
+			if fail {
+				return nil, errors.New("exit status 100")
+			}
+			return []byte("Inst openssl [3.0.11-1~deb12u1] (3.0.11-1~deb12u2 Debian-Security:12/stable-security [amd64])\n"), nil
+		})
+
+	u.refresh()
+	stats := u.Collect()
+	checkRebootState(t, stats)
+	if stats.Manager != "apt" || stats.Total != 1 || stats.Security != 1 {
+		t.Errorf("stats = %+v, want one apt security update", stats)
+	}
+
+	// A failed check drops the package data but not the reboot state
+	fail = true
+	u.refresh()
+	stats = u.Collect()
+	checkRebootState(t, stats)
+	if stats.Manager != "" || stats.Total != 0 {
+		t.Errorf("stats = %+v, want no package data", stats)
+	}
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Virtualization environments
+const (
+	EnvBareMetal = "bare-metal"
+	EnvVM        = "vm"
+	EnvContainer = "container"
+)
+
+// dmiHypervisors maps DMI sys_vendor/product_name substrings to the
+// systemd-detect-virt name of the hypervisor.
+var dmiHypervisors = []struct{ match, virt string }{
+	{"QEMU", "qemu"},
+	{"KVM", "kvm"},
+	{"VMware", "vmware"},
+	{"VirtualBox", "oracle"},
+	{"innotek", "oracle"},
+	{"Xen", "xen"},
+	{"Microsoft Corporation Virtual Machine", "microsoft"},
+	{"Parallels", "parallels"},
+	{"Amazon EC2", "amazon"},
+	{"Google Compute Engine", "google"},
+	{"BHYVE", "bhyve"},
+}
+
+// cgroupContainers maps cgroup v1 path fragments to the container runtime.
+var cgroupContainers = []struct{ match, virt string }{
+	{"/docker/", "docker"},
+	{"/docker-", "docker"},
+	{"/lxc/", "lxc"},
+	{"/lxc.payload", "lxc"},
+	{"/libpod-", "podman"},
+	{"/kubepods", "kubernetes"},
+}
+
+// Virtualization describes where the agent runs. Type uses the names of
+// systemd-detect-virt ("none" on bare metal), like the hardware and
+// discovery scripts.
+type Virtualization struct {
+	Environment      string   `json:"environment"` // bare-metal, vm or container
+	IsVirtual        bool     `json:"is_virtual"`
+	Type             string   `json:"type"`
+	Hypervisor       bool     `json:"hypervisor_flag"` // cpuinfo hypervisor flag
+	IsProxmoxHost    bool     `json:"is_proxmox_host"`
+	HasDocker        bool     `json:"has_docker"`
+	IsRaspberryPi    bool     `json:"is_raspberry_pi"`
+	RaspberryPiModel string   `json:"raspberry_pi_model,omitempty"`
+	Tags             []string `json:"tags"`
+}
+
+// readVirtualization detects containers first, because containers see the
+// DMI data and CPU flags of their host.
+func (i *InventoryCollector) readVirtualization(sys InventorySystem, cpu InventoryCPU) *Virtualization {
+	env := &Virtualization{
+		Environment:   EnvBareMetal,
+		Type:          "none",
+		Hypervisor:    strings.Contains(" "+cpu.Flags+" ", " hypervisor "),
+		IsProxmoxHost: i.isProxmox(),
+		HasDocker:     fileExists(i.dockerSocket),
+	}
+
+	if virt := i.detectContainer(); virt != "" {
+		env.Environment = EnvContainer
+		env.Type = virt
+	} else if virt := detectHypervisor(sys); virt != "" || env.Hypervisor {
+		env.Environment = EnvVM
+		env.Type = virt
+		if virt == "" {
+			env.Type = "vm-other"
+		}
+	}
+	env.IsVirtual = env.Environment != EnvBareMetal
+
+	if strings.HasPrefix(sys.Model, "Raspberry Pi") {
+		env.IsRaspberryPi = true
+		env.RaspberryPiModel = sys.Model
+	}
+
+	env.Tags = env.tags()
+	return env
+}
+
+// detectContainer returns the container runtime, or "" outside containers.
+func (i *InventoryCollector) detectContainer() string {
+	if fileExists(filepath.Join(i.rootPath, ".dockerenv")) {
+		return "docker"
+	}
+	if fileExists(filepath.Join(i.rootPath, "run", ".containerenv")) {
+		return "podman"
+	}
+
+	// LXC and systemd-nspawn set container= in the environment of init
+	if environ, err := os.ReadFile(filepath.Join(i.procPath, "1", "environ")); err == nil {
+		for _, v := range bytes.Split(environ, []byte{0}) {
+			if name, ok := bytes.CutPrefix(v, []byte("container=")); ok && len(name) > 0 {
+				return string(name)
+			}
+		}
+	}
+
+	// With cgroup v1 the path names the container; in a cgroup v2
+	// namespace it is just "0::/"
+	cgroup := readString(filepath.Join(i.procPath, "self", "cgroup"))
+	for _, c := range cgroupContainers {
+		if strings.Contains(cgroup, c.match) {
+			return c.virt
+		}
+	}
+
+	return ""
+}
+
+// detectHypervisor returns the hypervisor named in the DMI data, or "".
+func detectHypervisor(sys InventorySystem) string {
+	id := sys.Manufacturer + " " + sys.Product
+	for _, h := range dmiHypervisors {
+		if strings.Contains(id, h.match) {
+			return h.virt
+		}
+	}
+	return ""
+}
+
+// tags returns the node tags: bare-metal, vm, proxmox, docker and
+// raspberry-pi. The discovery script tags every KVM guest proxmox; the
+// agent cannot tell a Proxmox VM from other KVM guests, so only Proxmox
+// hosts and LXC containers are tagged proxmox.
+func (e *Virtualization) tags() []string {
+	tags := []string{}
+
+	switch e.Environment {
+	case EnvBareMetal:
+		tags = append(tags, "bare-metal")
+	case EnvVM:
+		tags = append(tags, "vm")
+	}
+
+	if e.IsProxmoxHost || e.Type == "lxc" {
+		tags = append(tags, "proxmox")
+	}
+	if e.HasDocker || e.Type == "docker" || e.Type == "podman" {
+		tags = append(tags, "docker")
+	}
+	if e.IsRaspberryPi {
+		tags = append(tags, "raspberry-pi")
+	}
+
+	return tags
+}
@@ -0,0 +1,306 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oidanice/nodepulse-agent/internal/config"
+)
+
+// zfsInterval is how often zpool and zfs are run. The kstats are cheap and
+// read on every collection.
+const zfsInterval = 60 * time.Second
+
+// ARCStats holds ZFS Adaptive Replacement Cache statistics.
+type ARCStats struct {
+	SizeBytes   int64   `json:"size_bytes"`
+	TargetBytes int64   `json:"target_bytes"` // c
+	MinBytes    int64   `json:"min_bytes"`    // c_min
+	MaxBytes    int64   `json:"max_bytes"`    // c_max
+	HitRatio    float64 `json:"hit_ratio"`    // percent, over the last interval
+	L2SizeBytes int64   `json:"l2_size_bytes"`
+	L2HitRatio  float64 `json:"l2_hit_ratio"` // percent, over the last interval
+	MemThrottle int64   `json:"memory_throttle_count"`
+}
+
+// ZPoolStats holds health, capacity and I/O of a pool.
+type ZPoolStats struct {
+	Name             string  `json:"name"`
+	Health           string  `json:"health"`
+	SizeBytes        int64   `json:"size_bytes"`
+	AllocBytes       int64   `json:"alloc_bytes"`
+	FreeBytes        int64   `json:"free_bytes"`
+	CapacityPercent  float64 `json:"capacity_percent"`
+	FragmentPercent  float64 `json:"fragmentation_percent"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadOpsPerSec    float64 `json:"read_ops_per_sec"`
+	WriteOpsPerSec   float64 `json:"write_ops_per_sec"`
+}
+
+// ZFSDatasetStats holds usage of a dataset.
+type ZFSDatasetStats struct {
+	Name           string  `json:"name"`
+	UsedBytes      int64   `json:"used_bytes"`
+	AvailableBytes int64   `json:"available_bytes"`
+	CompressRatio  float64 `json:"compress_ratio"`
+}
+
+// ZFSStats holds ARC, pool and dataset statistics.
+type ZFSStats struct {
+	ARC      *ARCStats         `json:"arc,omitempty"`
+	Pools    []ZPoolStats      `json:"pools"`
+	Datasets []ZFSDatasetStats `json:"datasets,omitempty"`
+}
+
+// zpoolIO holds the cumulative I/O counters of a pool.
+type zpoolIO struct {
+	nread, nwritten, reads, writes uint64
+}
+
+// ZFSCollector reads ZFS kstats and runs zpool/zfs for pool and dataset data.
+// zpool and zfs hang on pools with stuck I/O, so they run in the background
+// and Collect uses the lists of the last completed run.
+type ZFSCollector struct {
+	mu        sync.Mutex
+	kstatPath string
+	run       CommandRunner
+	datasets  []string
+
+	prevARC  map[string]int64
+	prevIO   map[string]zpoolIO
+	prevTime time.Time
+
+	lastList time.Time
+	listing  bool
+	pools    []ZPoolStats
+	dsStats  []ZFSDatasetStats
+}
+
+// NewZFSCollector creates a ZFS collector.
+func NewZFSCollector(cfg config.ZFSConfig) *ZFSCollector {
+	return &ZFSCollector{
+		kstatPath: "/proc/spl/kstat/zfs",
+		run:       runCommand,
+		datasets:  cfg.Datasets,
+	}
+}
+
+// Collect returns ZFS statistics, or nil if the ZFS module is not loaded.
+// Pools and datasets are missing until the first background listing
+// completes.
+func (z *ZFSCollector) Collect() *ZFSStats {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if !fileExists(z.kstatPath) {
+		return nil
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(z.prevTime).Seconds()
+
+	if !z.listing && now.Sub(z.lastList) >= zfsInterval {
+		z.lastList = now
+		z.listing = true
+		go z.refreshLists()
+	}
+
+	stats := &ZFSStats{
+		ARC:      z.readARC(),
+		Datasets: z.dsStats,
+	}
+
+	curIO := make(map[string]zpoolIO)
+	for _, pool := range z.pools {
+		io, ok := readPoolIO(filepath.Join(z.kstatPath, pool.Name))
+		if ok {
+			curIO[pool.Name] = io
+			if prev, seen := z.prevIO[pool.Name]; seen && elapsed > 0 {
+				pool.ReadBytesPerSec = float64(sub(io.nread, prev.nread)) / elapsed
+				pool.WriteBytesPerSec = float64(sub(io.nwritten, prev.nwritten)) / elapsed
+				pool.ReadOpsPerSec = float64(sub(io.reads, prev.reads)) / elapsed
+				pool.WriteOpsPerSec = float64(sub(io.writes, prev.writes)) / elapsed
+			}
+		}
+		stats.Pools = append(stats.Pools, pool)
+	}
+
+	z.prevIO = curIO
+	z.prevTime = now
+
+	return stats
+}
+
+// refreshLists runs zpool and zfs and stores the pools and datasets for
+// the next Collect.
+func (z *ZFSCollector) refreshLists() {
+	pools := z.listPools()
+	datasets := z.listDatasets()
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.pools = pools
+	z.dsStats = datasets
+	z.listing = false
+}
+
+// readARC parses arcstats. The hit ratios are computed from the hit/miss
+// deltas since the previous call, falling back to the totals since boot.
+func (z *ZFSCollector) readARC() *ARCStats {
+	kstat := readKstat(filepath.Join(z.kstatPath, "arcstats"))
+	if len(kstat) == 0 {
+		return nil
+	}
+
+	arc := &ARCStats{
+		SizeBytes:   kstat["size"],
+		TargetBytes: kstat["c"],
+		MinBytes:    kstat["c_min"],
+		MaxBytes:    kstat["c_max"],
+		L2SizeBytes: kstat["l2_size"],
+		MemThrottle: kstat["memory_throttle_count"],
+	}
+
+	prev := z.prevARC
+	if prev == nil {
+		prev = map[string]int64{}
+	}
+	arc.HitRatio = hitRatio(kstat["hits"]-prev["hits"], kstat["misses"]-prev["misses"])
+	arc.L2HitRatio = hitRatio(kstat["l2_hits"]-prev["l2_hits"], kstat["l2_misses"]-prev["l2_misses"])
+
+	z.prevARC = kstat
+	return arc
+}
+
+// hitRatio returns hits / (hits + misses) in percent.
+func hitRatio(hits, misses int64) float64 {
+	if hits < 0 || misses < 0 || hits+misses == 0 {
+		return 0
+	}
+	return 100.0 * float64(hits) / float64(hits+misses)
+}
+
+// listPools runs `zpool list` in parsable mode.
+func (z *ZFSCollector) listPools() []ZPoolStats {
+	out, err := z.run("zpool", "list", "-Hp", "-o", "name,size,alloc,free,frag,cap,health")
+	if err != nil {
+		return nil
+	}
+
+	var pools []ZPoolStats
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+
+		p := ZPoolStats{Name: fields[0], Health: fields[6]}
+		p.SizeBytes, _ = strconv.ParseInt(fields[1], 10, 64)
+		p.AllocBytes, _ = strconv.ParseInt(fields[2], 10, 64)
+		p.FreeBytes, _ = strconv.ParseInt(fields[3], 10, 64)
+		// frag is "-" for pools without free space map (e.g. just created)
+		p.FragmentPercent, _ = strconv.ParseFloat(strings.TrimSuffix(fields[4], "%"), 64)
+		p.CapacityPercent, _ = strconv.ParseFloat(strings.TrimSuffix(fields[5], "%"), 64)
+		pools = append(pools, p)
+	}
+
+	return pools
+}
+
+// listDatasets runs `zfs list` for the configured datasets.
+func (z *ZFSCollector) listDatasets() []ZFSDatasetStats {
+	if len(z.datasets) == 0 {
+		return nil
+	}
+
+	args := append([]string{"list", "-Hp", "-o", "name,used,avail,compressratio"}, z.datasets...)
+	// zfs list exits non-zero if one dataset is missing but still lists the others
+	out, _ := z.run("zfs", args...)
+
+	var datasets []ZFSDatasetStats
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 {
+			continue
+		}
+
+		d := ZFSDatasetStats{Name: fields[0]}
+		d.UsedBytes, _ = strconv.ParseInt(fields[1], 10, 64)
+		d.AvailableBytes, _ = strconv.ParseInt(fields[2], 10, 64)
+		d.CompressRatio, _ = strconv.ParseFloat(strings.TrimSuffix(fields[3], "x"), 64)
+		datasets = append(datasets, d)
+	}
+
+	return datasets
+}
+
+// readPoolIO reads the I/O counters of a pool. Older ZFS versions provide
+// a pool-wide "io" kstat; OpenZFS 2.x only has per-dataset objset-* kstats,
+// which are summed up.
+func readPoolIO(dir string) (zpoolIO, bool) {
+	var io zpoolIO
+
+	if data, err := os.ReadFile(filepath.Join(dir, "io")); err == nil {
+		// Format: header line, column names, then
+		// nread nwritten reads writes wtime wlentime ...
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) >= 3 {
+			fields := strings.Fields(lines[2])
+			if len(fields) >= 4 {
+				io.nread, _ = strconv.ParseUint(fields[0], 10, 64)
+				io.nwritten, _ = strconv.ParseUint(fields[1], 10, 64)
+				io.reads, _ = strconv.ParseUint(fields[2], 10, 64)
+				io.writes, _ = strconv.ParseUint(fields[3], 10, 64)
+				return io, true
+			}
+		}
+	}
+
+	objsets, _ := filepath.Glob(filepath.Join(dir, "objset-*"))
+	for _, objset := range objsets {
+		kstat := readKstat(objset)
+		io.nread += uint64(kstat["nread"])
+		io.nwritten += uint64(kstat["nwritten"])
+		io.reads += uint64(kstat["reads"])
+		io.writes += uint64(kstat["writes"])
+	}
+
+	return io, len(objsets) > 0
+}
+
+// readKstat parses a named kstat file ("name type data" rows after a
+// two-line header) into a map. Non-numeric values are skipped.
+func readKstat(path string) map[string]int64 {
+	values := make(map[string]int64)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if lineNum <= 2 {
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if v, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+
+	return values
+}
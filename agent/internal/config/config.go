@@ -15,6 +15,28 @@ const (
 	DefaultPushInterval = 5
 	// DefaultLogLevel is the default logging level.
 	DefaultLogLevel = "info"
+	// DefaultTopProcesses is the default number of processes in the top lists.
+	DefaultTopProcesses = 10
+	// DefaultCmdlineLength is the default maximum length of a reported command line.
+	DefaultCmdlineLength = 256
+	// DefaultDockerSocket is the default Docker Engine API socket.
+	DefaultDockerSocket = "/var/run/docker.sock"
+	// DefaultPVEPath is the Proxmox cluster filesystem mount point.
+	DefaultPVEPath = "/etc/pve"
+	// DefaultRunPath is the runtime state directory.
+	DefaultRunPath = "/run"
+	// DefaultProcPath is the procfs mount point.
+	DefaultProcPath = "/proc"
+	// DefaultCgroupPath is the cgroup filesystem mount point.
+	DefaultCgroupPath = "/sys/fs/cgroup"
+	// DefaultThinWarnPercent is the default thin pool usage warning threshold.
+	DefaultThinWarnPercent = 80
+	// DefaultThinCritPercent is the default thin pool usage critical threshold.
+	DefaultThinCritPercent = 90
+	// DefaultSMARTInterval is the default SMART polling interval in seconds.
+	DefaultSMARTInterval = 3600
+	// DefaultUpdatesInterval is the default package update check interval in seconds.
+	DefaultUpdatesInterval = 21600
 )
 
 // Config holds the agent configuration.
@@ -24,6 +46,100 @@ type Config struct {
 	NodeID       int    `json:"node_id"`
 	PushInterval int    `json:"push_interval"`
 	LogLevel     string `json:"log_level"`
+
+	Filesystems FilesystemConfig `json:"filesystems"`
+	DiskIO      DiskIOConfig     `json:"disk_io"`
+	Sensors     SensorConfig     `json:"sensors"`
+	Processes   ProcessConfig    `json:"processes"`
+	Docker      DockerConfig     `json:"docker"`
+	Proxmox     ProxmoxConfig    `json:"proxmox"`
+	Systemd     SystemdConfig    `json:"systemd"`
+	ZFS         ZFSConfig        `json:"zfs"`
+	LVM         LVMConfig        `json:"lvm"`
+	SMART       SMARTConfig      `json:"smart"`
+	Updates     UpdatesConfig    `json:"updates"`
+}
+
+// FilesystemConfig selects which mounts the filesystem collector reports.
+// Entries are shell patterns as understood by path.Match, e.g. "/mnt/*".
+// An empty include list means "everything not excluded".
+type FilesystemConfig struct {
+	IncludeMountpoints []string `json:"include_mountpoints"`
+	ExcludeMountpoints []string `json:"exclude_mountpoints"`
+	IncludeFSTypes     []string `json:"include_fs_types"`
+	ExcludeFSTypes     []string `json:"exclude_fs_types"`
+}
+
+// DiskIOConfig selects which block devices the disk I/O collector reports.
+// Device names are matched with path.Match against the kernel name ("sda",
+// "nvme0n1", "dm-0"). Loop, ram and zram devices are skipped unless included.
+type DiskIOConfig struct {
+	IncludeDevices    []string `json:"include_devices"`
+	ExcludeDevices    []string `json:"exclude_devices"`
+	IncludePartitions bool     `json:"include_partitions"`
+}
+
+// SensorConfig controls the hardware sensor collector.
+type SensorConfig struct {
+	// CPUTemp selects the sensor reported as temp_cpu, as "chip/label"
+	// (e.g. "coretemp/Package id 0") or "chip" (e.g. "cpu_thermal").
+	// Empty uses the built-in priority list.
+	CPUTemp string `json:"cpu_temp"`
+}
+
+// ProcessConfig controls the top process lists.
+type ProcessConfig struct {
+	TopN          int `json:"top_n"`
+	CmdlineLength int `json:"cmdline_length"`
+}
+
+// DockerConfig controls the Docker collector. Socket may point to any
+// Docker-compatible API, e.g. /run/podman/podman.sock.
+type DockerConfig struct {
+	Socket string `json:"socket"`
+}
+
+// ProxmoxConfig holds the paths the Proxmox guest collector reads from.
+// CgroupPath is also used for the per-service and per-guest cgroup usage.
+type ProxmoxConfig struct {
+	PVEPath    string `json:"pve_path"`
+	RunPath    string `json:"run_path"`
+	ProcPath   string `json:"proc_path"`
+	CgroupPath string `json:"cgroup_path"`
+}
+
+// SystemdConfig controls the systemd unit collector. WatchUnits are always
+// reported with their state and restart count; a missing suffix means
+// ".service".
+type SystemdConfig struct {
+	WatchUnits []string `json:"watch_units"`
+}
+
+// ZFSConfig lists the datasets (e.g. "rpool/data") whose usage is reported.
+type ZFSConfig struct {
+	Datasets []string `json:"datasets"`
+}
+
+// LVMConfig holds the thin pool usage thresholds (percent) at which the
+// LVM collector raises events. They apply to data and metadata usage.
+type LVMConfig struct {
+	ThinWarnPercent float64 `json:"thin_warn_percent"`
+	ThinCritPercent float64 `json:"thin_crit_percent"`
+}
+
+// SMARTConfig controls the SMART collector. Interval is in seconds; disks
+// in standby are not woken up. ExcludeDevices are matched with path.Match
+// against the kernel name ("sda", "nvme0n1").
+type SMARTConfig struct {
+	Interval       int      `json:"interval"`
+	ExcludeDevices []string `json:"exclude_devices"`
+}
+
+// UpdatesConfig controls the pending package update check. Interval is in
+// seconds. The package lists are not refreshed by the agent; that is left
+// to the distribution's own timers (apt-daily, dnf-makecache).
+type UpdatesConfig struct {
+	Interval int `json:"interval"`
 }
 
 // Load reads the configuration from the specified file path.
@@ -54,6 +170,39 @@ func Load(path string) (*Config, error) {
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = DefaultLogLevel
 	}
+	if cfg.Processes.TopN <= 0 {
+		cfg.Processes.TopN = DefaultTopProcesses
+	}
+	if cfg.Processes.CmdlineLength <= 0 {
+		cfg.Processes.CmdlineLength = DefaultCmdlineLength
+	}
+	if cfg.Docker.Socket == "" {
+		cfg.Docker.Socket = DefaultDockerSocket
+	}
+	if cfg.Proxmox.PVEPath == "" {
+		cfg.Proxmox.PVEPath = DefaultPVEPath
+	}
+	if cfg.Proxmox.RunPath == "" {
+		cfg.Proxmox.RunPath = DefaultRunPath
+	}
+	if cfg.Proxmox.ProcPath == "" {
+		cfg.Proxmox.ProcPath = DefaultProcPath
+	}
+	if cfg.Proxmox.CgroupPath == "" {
+		cfg.Proxmox.CgroupPath = DefaultCgroupPath
+	}
+	if cfg.LVM.ThinWarnPercent <= 0 {
+		cfg.LVM.ThinWarnPercent = DefaultThinWarnPercent
+	}
+	if cfg.LVM.ThinCritPercent <= 0 {
+		cfg.LVM.ThinCritPercent = DefaultThinCritPercent
+	}
+	if cfg.SMART.Interval <= 0 {
+		cfg.SMART.Interval = DefaultSMARTInterval
+	}
+	if cfg.Updates.Interval <= 0 {
+		cfg.Updates.Interval = DefaultUpdatesInterval
+	}
 
 	// Validate required fields
 	if cfg.ServerURL == "" {
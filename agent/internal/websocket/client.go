@@ -14,6 +14,8 @@ import (
 // Message types
 const (
 	TypeMetrics   = "metrics"
+	TypeEvent     = "event"
+	TypeInventory = "inventory"
 	TypeHeartbeat = "heartbeat"
 	TypeInfo      = "info"
 	TypeResponse  = "response"
@@ -41,6 +43,19 @@ type MetricsMessage struct {
 	Data interface{} `json:"data"`
 }
 
+// EventMessage reports a state change, e.g. a degraded RAID array.
+type EventMessage struct {
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// InventoryMessage carries the static host inventory.
+type InventoryMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
 // CommandMessage is received from the server.
 type CommandMessage struct {
 	Type    string                 `json:"type"`
@@ -75,6 +90,7 @@ type Client struct {
 
 	// Callbacks
 	onCommand func(cmd *CommandMessage) *ResponseMessage
+	inventory func() interface{}
 }
 
 // NewClient creates a new WebSocket client.
@@ -94,6 +110,12 @@ func (c *Client) SetCommandHandler(handler func(cmd *CommandMessage) *ResponseMe
 	c.onCommand = handler
 }
 
+// SetInventoryProvider sets the callback for the inventory sent after
+// every connect.
+func (c *Client) SetInventoryProvider(provider func() interface{}) {
+	c.inventory = provider
+}
+
 // Connect establishes the WebSocket connection.
 func (c *Client) Connect() error {
 	c.mu.Lock()
@@ -127,6 +149,17 @@ func (c *Client) Connect() error {
 		logger.Warn("Failed to send info message: %v", err)
 	}
 
+	// Send the inventory, the server may have missed changes while disconnected
+	if c.inventory != nil {
+		msg := InventoryMessage{
+			Type: TypeInventory,
+			Data: c.inventory(),
+		}
+		if err := c.sendJSON(msg); err != nil {
+			logger.Warn("Failed to send inventory message: %v", err)
+		}
+	}
+
 	logger.Info("Connected to server")
 
 	// Start read loop in goroutine
@@ -164,6 +197,25 @@ func (c *Client) SendMetrics(data interface{}) error {
 	return c.Send(msg)
 }
 
+// SendEvent sends an event to the server.
+func (c *Client) SendEvent(event string, data interface{}) error {
+	msg := EventMessage{
+		Type:  TypeEvent,
+		Event: event,
+		Data:  data,
+	}
+	return c.Send(msg)
+}
+
+// SendInventory sends the host inventory to the server.
+func (c *Client) SendInventory(data interface{}) error {
+	msg := InventoryMessage{
+		Type: TypeInventory,
+		Data: data,
+	}
+	return c.Send(msg)
+}
+
 // readLoop reads messages from the WebSocket.
 func (c *Client) readLoop() {
 	for {
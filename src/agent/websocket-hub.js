@@ -14,6 +14,7 @@
 
 var WebSocket = require('ws');
 var db = require('../db');
+var statsRouter = require('../routes/api/stats');
 
 // Connected agents: Map<nodeId, WebSocket>
 var connections = new Map();
@@ -33,6 +34,20 @@ var COMMAND_TIMEOUT = 60000;
 // Heartbeat timer
 var heartbeatTimer = null;
 
+// hardware.sh fields the agent does not report: inventory section -> field -> node_hardware column
+var INVENTORY_KEEP_FIELDS = {
+  cpu: {
+    cache_l1: 'cpu_cache_l1',
+    cache_l2: 'cpu_cache_l2',
+    cache_l3: 'cpu_cache_l3',
+    cur_mhz: 'cpu_cur_mhz'
+  },
+  memory: {
+    type: 'ram_type',
+    speed_mhz: 'ram_speed_mhz'
+  }
+};
+
 /**
  * Initialize WebSocket server
  * @param {Object} options - Server options
@@ -184,6 +199,10 @@ function handleMessage(ws, nodeId, data) {
       handleAgentInfo(nodeId, message);
       break;
 
+    case 'inventory':
+      handleInventory(nodeId, message);
+      break;
+
     default:
       console.warn('[AgentHub] Unknown message type from node ' + nodeId + ':', type);
   }
@@ -280,6 +299,99 @@ function handleAgentInfo(nodeId, message) {
   console.log('[AgentHub] Agent info for node ' + nodeId + ':', info);
 }
 
+/**
+ * Handle host inventory from agent (sent on connect and on changes).
+ * The layout matches hardware.sh; sections the agent does not report
+ * (network, gpu, thermal, power, memory slots) and the CPU cache, current
+ * clock and RAM type and speed are kept from the last SSH collection. OS
+ * and kernel update the discovery and health data.
+ * @param {number} nodeId - Node ID
+ * @param {Object} message - Inventory message
+ */
+function handleInventory(nodeId, message) {
+  var data = message.data || {};
+
+  try {
+    var existing = db.hardware.getForNode(nodeId);
+    if (existing) {
+      var keep = {
+        network: existing.network_json,
+        gpu: existing.gpu_json,
+        thermal: existing.thermal_json,
+        power: existing.power_json,
+        memory_slots: existing.memory_slots_json
+      };
+      Object.keys(keep).forEach(function(key) {
+        if (data[key] === undefined && keep[key]) {
+          data[key] = JSON.parse(keep[key]);
+        }
+      });
+      Object.keys(INVENTORY_KEEP_FIELDS).forEach(function(section) {
+        var fields = INVENTORY_KEEP_FIELDS[section];
+        data[section] = data[section] || {};
+        Object.keys(fields).forEach(function(field) {
+          var column = fields[field];
+          if (data[section][field] === undefined && existing[column] != null) {
+            data[section][field] = existing[column];
+          }
+        });
+      });
+      if (data.virtualization === undefined) {
+        data.virtualization = {
+          is_virtual: existing.is_virtual === 1,
+          type: existing.virt_type
+        };
+      }
+    }
+
+    db.hardware.save(nodeId, data);
+
+    // OS and kernel go where the SSH discovery and health check put them
+    var os = data.os || {};
+    var kernel = data.kernel || {};
+    db.discovery.saveOs(nodeId, {
+      os_id: os.id,
+      os_name: os.pretty_name || os.name,
+      arch: kernel.machine,
+      hostname: kernel.hostname
+    });
+    if (kernel.release) {
+      db.health.setKernel(nodeId, kernel.release);
+    }
+
+    // Hardware changed → metadata hash must be recalculated
+    statsRouter.clearMetadataHashCache(nodeId);
+
+    // Auto-tag from the detected environment (bare-metal, vm, proxmox, ...)
+    if (data.virtualization && Array.isArray(data.virtualization.tags)) {
+      applyInventoryTags(nodeId, data.virtualization.tags);
+    }
+
+    console.log('[AgentHub] Inventory for node ' + nodeId + ' updated');
+  } catch (err) {
+    console.error('[AgentHub] Failed to save inventory for node ' + nodeId + ':', err.message);
+  }
+}
+
+/**
+ * Add the tags reported by the agent to a node. Only existing tags are
+ * applied, like the auto-tagging of the discovery.
+ * @param {number} nodeId - Node ID
+ * @param {string[]} tagNames - Tag names
+ */
+function applyInventoryTags(nodeId, tagNames) {
+  var tagMap = {};
+  db.tags.getAll().forEach(function(tag) {
+    tagMap[tag.name] = tag.id;
+  });
+
+  tagNames.forEach(function(name) {
+    if (tagMap[name]) {
+      db.tags.addToNode(nodeId, tagMap[name]);
+    }
+  });
+}
+
 /**
  * Handle agent disconnect
  * @param {number} nodeId - Node ID
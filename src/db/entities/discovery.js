@@ -94,6 +94,31 @@ const discovery = {
     });
   },
 
+  /**
+   * Save or update only the OS facts of a node (os_id, os_name, arch,
+   * hostname), as reported by the agent inventory. The other discovery
+   * data is left alone.
+   */
+  saveOs(nodeId, data) {
+    const stmt = getDb().prepare(`
+      INSERT INTO node_discovery (node_id, arch, os_id, os_name, hostname, discovered_at)
+      VALUES (@node_id, @arch, @os_id, @os_name, @hostname, CURRENT_TIMESTAMP)
+      ON CONFLICT(node_id) DO UPDATE SET
+        arch = COALESCE(excluded.arch, arch),
+        os_id = COALESCE(excluded.os_id, os_id),
+        os_name = COALESCE(excluded.os_name, os_name),
+        hostname = COALESCE(excluded.hostname, hostname)
+    `);
+
+    return stmt.run({
+      node_id: nodeId,
+      arch: data.arch || null,
+      os_id: data.os_id || null,
+      os_name: data.os_name || null,
+      hostname: data.hostname || null,
+    });
+  },
+
   /**
    * Delete discovery data for a node
    */
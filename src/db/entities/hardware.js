@@ -31,6 +31,7 @@ const hardware = {
         memory_slots_json, pci_devices_json,
         is_virtual, virt_type,
         disks_json, network_json, gpu_json, thermal_json, power_json,
+        usb_devices_json,
         updated_at
       ) VALUES (
         @node_id,
@@ -42,6 +43,7 @@ const hardware = {
         @memory_slots_json, @pci_devices_json,
         @is_virtual, @virt_type,
         @disks_json, @network_json, @gpu_json, @thermal_json, @power_json,
+        @usb_devices_json,
         CURRENT_TIMESTAMP
       )
       ON CONFLICT(node_id) DO UPDATE SET
@@ -79,6 +81,8 @@ const hardware = {
         gpu_json = excluded.gpu_json,
         thermal_json = excluded.thermal_json,
         power_json = excluded.power_json,
+        -- Only the agent reports USB devices, keep them on SSH collections
+        usb_devices_json = COALESCE(excluded.usb_devices_json, usb_devices_json),
         updated_at = CURRENT_TIMESTAMP
     `);
 
@@ -127,6 +131,7 @@ const hardware = {
       gpu_json: JSON.stringify(data.gpu || []),
       thermal_json: JSON.stringify(data.thermal || []),
       power_json: JSON.stringify(data.power || []),
+      usb_devices_json: data.usb_devices ? JSON.stringify(data.usb_devices) : null,
     });
   },
 
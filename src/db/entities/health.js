@@ -89,6 +89,14 @@ var health = {
     );
   },
 
+  // Update only the kernel version, e.g. from the agent inventory
+  setKernel: function(nodeId, kernelVersion) {
+    return getDb().prepare(`
+      INSERT INTO node_health (node_id, kernel_version) VALUES (?, ?)
+      ON CONFLICT(node_id) DO UPDATE SET kernel_version = excluded.kernel_version
+    `).run(nodeId, kernelVersion);
+  },
+
   // Delete health data for a node
   delete: function(nodeId) {
     return getDb().prepare('DELETE FROM node_health WHERE node_id = ?').run(nodeId);
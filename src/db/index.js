@@ -103,6 +103,19 @@ async function init() {
       throw err;
     }
 
+    // Migration: Add usb_devices_json column to node_hardware
+    try {
+      const columns = db.prepare("PRAGMA table_info(node_hardware)").all();
+      const hasUsb = columns.some(col => col.name === 'usb_devices_json');
+      if (!hasUsb) {
+        db.exec('ALTER TABLE node_hardware ADD COLUMN usb_devices_json TEXT');
+        console.log('[DB] Migration: Added usb_devices_json column');
+      }
+    } catch (err) {
+      console.error('[DB] Migration error (usb):', err.message);
+      throw err;
+    }
+
     // Migration: Create node_health table if not exists
     try {
       db.exec(`
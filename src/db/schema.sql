@@ -151,6 +151,9 @@ CREATE TABLE IF NOT EXISTS node_hardware (
     -- Power sensors (JSON array)
     power_json TEXT,
 
+    -- USB devices (JSON array, agent only)
+    usb_devices_json TEXT,
+
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
 );